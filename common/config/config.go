@@ -94,6 +94,10 @@ var Users struct {
 	AvatarDb string
 }
 
+var Wikis struct {
+	EditLeaseTimeout uint64
+}
+
 var Notifications struct {
 	TemplateDir      string
 	UseHtmlTemplates bool
@@ -135,6 +139,7 @@ func LoadDefaults() {
 	Auth.AllowNewUserRegistration = false
 	Auth.MinPasswordLength = 6
 	Users.AvatarDb = "avatar_ut"
+	Wikis.EditLeaseTimeout = 120
 	Notifications.TemplateDir = "templates"
 	Notifications.UseHtmlTemplates = true
 	Notifications.MainSiteUrl = "http://localhost:8081"
@@ -46,6 +46,7 @@ var LogConfigLocation = ConfigPrefix + "log/"
 var AuthConfigLocation = ConfigPrefix + "auth/"
 var NotificationsConfigLocation = ConfigPrefix + "notifications/"
 var UsersConfigLocation = ConfigPrefix + "users/"
+var WikisConfigLocation = ConfigPrefix + "wikis/"
 var FrontendConfigLocation = ConfigPrefix + "frontend/"
 var RegistryConfigLocation = ConfigPrefix + "registry/"
 
@@ -117,7 +118,7 @@ func FetchServiceSection(service ServiceSection) {
 	case NotificationService:
 		fetchConfigSection(&Notifications, NotificationsConfigLocation, kapi)
 	case WikiService:
-		//Do nothing
+		fetchConfigSection(&Wikis, WikisConfigLocation, kapi)
 	case FrontendService:
 		fetchConfigSection(&Frontend, FrontendConfigLocation, kapi)
 	default:
@@ -69,6 +69,7 @@ func LoadConfig(filename string) {
 	//Optional sections
 	frontendSection, err := config.Section("Frontend")
 	userSection, err := config.Section("Users")
+	wikiSection, err := config.Section("Wikis")
 	searchSection, err := config.Section("Search")
 	notifSection, err := config.Section("Notifications")
 	if frontendSection != nil {
@@ -80,6 +81,9 @@ func LoadConfig(filename string) {
 	if userSection != nil {
 		setUsersConfig(userSection)
 	}
+	if wikiSection != nil {
+		setWikisConfig(wikiSection)
+	}
 	if notifSection != nil {
 		setNotificationConfig(notifSection)
 	}
@@ -253,3 +257,13 @@ func setUsersConfig(userSection *configparser.Section) {
 		}
 	}
 }
+
+// Load Wikis configuration
+func setWikisConfig(wikiSection *configparser.Section) {
+	for key, value := range wikiSection.Options() {
+		switch key {
+		case "editLeaseTimeout":
+			setUint64Val(value, &Wikis.EditLeaseTimeout)
+		}
+	}
+}
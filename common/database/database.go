@@ -36,6 +36,7 @@ import (
 	"github.com/rhinoman/wikifeat/common/entities"
 	"github.com/twinj/uuid"
 	"log"
+	"reflect"
 	"strconv"
 	"time"
 )
@@ -283,6 +284,29 @@ func setDbSecurity(dbName string) error {
 
 func InitMainDatabase() error {
 	mainDb := Connection.SelectDB(MainDbName(), AdminAuth)
+	_, err := mainDb.SaveDesignDoc("wiki_query", mainDesignDoc(), "")
+	return err
+}
+
+//Brings the main database's views up to date
+func UpdateMainDatabase() error {
+	mainDb := Connection.SelectDB(MainDbName(), AdminAuth)
+	ddoc := mainDesignDoc()
+	current := DesignDocument{}
+	rev, err := mainDb.Read("_design/wiki_query", &current, nil)
+	if cErr, ok := err.(*couchdb.Error); ok && cErr.StatusCode == 404 {
+		rev = ""
+	} else if err != nil {
+		return err
+	} else if reflect.DeepEqual(current.Views, ddoc.Views) &&
+		reflect.DeepEqual(current.Lists, ddoc.Lists) {
+		return nil
+	}
+	_, err = mainDb.SaveDesignDoc("wiki_query", ddoc, rev)
+	return err
+}
+
+func mainDesignDoc() DesignDocument {
 	getWikis := `
 		function(doc) {
 			if(doc.type==="wiki_record"){
@@ -297,6 +321,15 @@ func InitMainDatabase() error {
 			}
 		}
 	`
+	getWikiByPreviousSlug := `
+		function(doc) {
+			if(doc.type==="wiki_record" && doc.previousSlugs){
+				for(var i in doc.previousSlugs){
+					emit(doc.previousSlugs[i], {wikiRev: doc._rev, wiki_record: doc});
+				}
+			}
+		}
+	`
 	userWikiList := `
 		function(head, req){
 			var row;
@@ -323,15 +356,14 @@ func InitMainDatabase() error {
 	`
 	gw := DesignView{Map: getWikis}
 	gwbs := DesignView{Map: getWikiBySlug}
+	gwbps := DesignView{Map: getWikiByPreviousSlug}
 	cus := DesignView{Map: checkUniqueSlug, Reduce: "_count"}
-	ddoc := DesignDocument{
+	return DesignDocument{
 		Language: "javascript",
 		Views: map[string]DesignView{"getWikis": gw, "getWikiBySlug": gwbs,
-			"checkUniqueSlug": cus},
+			"getWikiByPreviousSlug": gwbps, "checkUniqueSlug": cus},
 		Lists: map[string]string{"userWikiList": userWikiList},
 	}
-	_, err := mainDb.SaveDesignDoc("wiki_query", ddoc, "")
-	return err
 }
 
 //Select connection function (SSL or not)
@@ -109,6 +109,9 @@ type WikiRecord struct {
 	HomePageId  string    `json:"homePageId,omitempty"`
 	AllowGuest  bool      `json:"allowGuest"`
 	Type        string    `json:"type"`
+	//Slugs the wiki had before it was renamed, and when it last was
+	PreviousSlugs []string   `json:"previousSlugs,omitempty"`
+	RenamedAt     *time.Time `json:"renamedAt,omitempty"`
 }
 
 func (wr WikiRecord) Validate() error {
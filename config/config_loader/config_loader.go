@@ -80,6 +80,8 @@ func SetConfig() {
 	setConfigItems(config.Notifications, config.NotificationsConfigLocation)
 	log.Println("Setting users config")
 	setConfigItems(config.Users, config.UsersConfigLocation)
+	log.Println("Setting wikis config")
+	setConfigItems(config.Wikis, config.WikisConfigLocation)
 	log.Println("Setting frontend config")
 	setConfigItems(config.Frontend, config.FrontendConfigLocation)
 }
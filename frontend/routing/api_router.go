@@ -37,6 +37,8 @@ import (
 )
 
 func handleApiRoutes(ar *mux.Router) {
+	//User activity is gathered from the wikis
+	ar.Path("/users/{user-id}/activity").HandlerFunc(wikiHandler)
 	ar.PathPrefix("/users").HandlerFunc(userHandler)
 	ar.PathPrefix("/wikis").HandlerFunc(wikiHandler)
 	ar.PathPrefix("/auth").HandlerFunc(authHandler)
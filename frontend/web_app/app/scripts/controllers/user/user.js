@@ -37,9 +37,10 @@ define([
     'backbone.radio',
     'views/user/manage_users',
     'views/user/manage_members',
-    'views/user/account_settings'
+    'views/user/account_settings',
+    'views/user/user_info_dialog'
 ], function($,_,Marionette,Radio,ManageUsersView,
-            ManageMembersView,AccountSettingsView){
+            ManageMembersView,AccountSettingsView,UserInfoDialog){
     var userChannel = Radio.channel('user');
 
     var UserController = Marionette.Controller.extend({
@@ -86,6 +87,19 @@ define([
                 });
         },
 
+        showUser: function(name){
+            Radio.channel('userManager').request('get:user', name)
+                .done(function(user){
+                    if(typeof user === 'undefined'){
+                        console.log("Error loading user " + name);
+                        return;
+                    }
+                    user.set('name', name);
+                    var userInfoDialog = new UserInfoDialog({model: user});
+                    Radio.channel('main').trigger('show:dialog', userInfoDialog);
+                });
+        },
+
         manageMembers: function(wikiModel){
             Radio.channel('userManager').request('get:wikiMemberList', wikiModel)
                 .done(function(memberList){
@@ -120,6 +134,10 @@ define([
         userController.manageUsers();
     });
 
+    userChannel.on("show:user", function(name){
+        userController.showUser(name);
+    });
+
     userChannel.on("manage:members", function(wikiModel){
         userController.manageMembers(wikiModel);
     });
@@ -43,7 +43,8 @@ define([
     return Marionette.AppRouter.extend({
         appRoutes: {
             "users/manage": "manageUsers",
-            "users/account": "accountSettings"
+            "users/account": "accountSettings",
+            "users/:name": "showUser"
         },
         controller: {
             manageUsers: function(){
@@ -51,6 +52,9 @@ define([
             },
             accountSettings: function(){
                 Radio.channel('user').trigger('user:accountSettings');
+            },
+            showUser: function(name){
+                Radio.channel('user').trigger('show:user', name);
             }
         }
     });
@@ -53,6 +53,9 @@ define([
                 if(theWiki){
                     Radio.channel('wiki').trigger('show:wiki', theWiki, thePage);
                 }
+            } else if(path[0] === "app" && path[1] === "users" && path[2]){
+                //A link to a user's profile, from an @mention
+                Radio.channel('user').trigger('show:user', path[2]);
             }
             //Other possibilities... plugins
         }
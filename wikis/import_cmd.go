@@ -0,0 +1,131 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"github.com/rhinoman/wikifeat/common/config"
+	"github.com/rhinoman/wikifeat/common/database"
+	"github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/common/services"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service"
+	"log"
+	"os"
+)
+
+//Imports a zip archive of markdown documents, or a MediaWiki XML export,
+//from the command line:
+//  wikis import -wiki=<wiki slug> -user=<user name> archive.zip
+//  wikis import -format=mediawiki -wiki=<wiki slug> -user=<user name> dump.xml
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	registryLocation := flags.String("registryLocation", "http://localhost:2379",
+		"URL for etcd")
+	wikiSlug := flags.String("wiki", "", "Slug of the wiki to import into")
+	userName := flags.String("user", "", "User name to record as the owner of the pages")
+	format := flags.String("format", "markdown",
+		"Format of the import file: markdown (zip archive) or mediawiki (XML export)")
+	flags.Parse(args)
+	if *wikiSlug == "" || *userName == "" || flags.NArg() != 1 ||
+		(*format != "markdown" && *format != "mediawiki") {
+		fmt.Fprintln(os.Stderr, "Usage: wikis import [-format=markdown|mediawiki] "+
+			"-wiki=<wiki slug> -user=<user name> file")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	config.LoadDefaults()
+	config.Service.RegistryLocation = *registryLocation
+	config.InitEtcd()
+	config.FetchCommonConfig()
+	config.FetchServiceSection(config.WikiService)
+	database.InitDb()
+	curUser := services.GetAdminUser()
+	curUser.User.UserName = *userName
+	wr := entities.WikiRecord{}
+	if _, err := new(wiki_service.WikiManager).ReadBySlug(*wikiSlug,
+		&wr, curUser); err != nil {
+		log.Fatalf("Error reading wiki %v: %v", *wikiSlug, err)
+	}
+	if *format == "mediawiki" {
+		importMediaWiki(wr.Id, flags.Arg(0), curUser)
+	} else {
+		importArchive(wr.Id, flags.Arg(0), curUser)
+	}
+}
+
+func importArchive(wikiId string, fileName string, curUser *entities.CurrentUserInfo) {
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer archive.Close()
+	result, err := new(wiki_service.ImportManager).Import(wikiId,
+		&archive.Reader, curUser)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Created %v pages and %v files\n", len(result.Pages), len(result.Files))
+	for _, failure := range result.Failed {
+		fmt.Printf("Failed: %v: %v\n", failure.Path, failure.Reason)
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func importMediaWiki(wikiId string, fileName string, curUser *entities.CurrentUserInfo) {
+	dump, err := os.Open(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dump.Close()
+	result, err := new(wiki_service.ImportManager).ImportMediaWiki(wikiId,
+		dump, curUser)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, page := range result.Pages {
+		if page.Error != "" {
+			fmt.Printf("Skipped: %v: %v\n", page.Title, page.Error)
+			continue
+		}
+		fmt.Printf("Created: %v (%v revisions)\n", page.Title, page.Revisions)
+		for _, construct := range page.Unsupported {
+			fmt.Printf("  Not converted: %v\n", construct)
+		}
+	}
+	if result.Error != "" {
+		fmt.Printf("Error reading %v: %v\n", fileName, result.Error)
+		os.Exit(1)
+	}
+}
@@ -40,9 +40,14 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 	"log"
 	"net/http"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
 	// Load default config
 	config.LoadDefaults()
 	// Parse the command line parameters
@@ -71,6 +76,10 @@ func main() {
 	wc := wiki_service.WikisController{}
 	wc.Register(wsContainer)
 	database.InitDb()
+	if err := new(wiki_service.WikiManager).UpdateWikiDatabases(); err != nil {
+		log.Printf("Error updating wiki databases: %v", err)
+	}
+	wiki_service.StartSearchIndexer()
 	registry.Init("Wikis", registry.WikisLocation)
 	httpAddr := ":" + config.Service.Port
 	if config.Service.UseSSL == true {
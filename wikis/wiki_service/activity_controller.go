@@ -0,0 +1,108 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+package wiki_service
+
+import (
+	"github.com/emicklei/go-restful"
+	. "github.com/rhinoman/wikifeat/common/services"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+)
+
+//Lists what users have been doing across the wikis.
+//The routes live under the users uri; the frontend sends them here.
+type ActivityController struct{}
+
+type ActivityResponse struct {
+	Links    HatLinks       `json:"_links"`
+	PageNum  int            `json:"pageNum"`
+	Activity []wikit.Change `json:"activity"`
+}
+
+func (ac ActivityController) usersUri() string {
+	return ApiPrefix() + "/users"
+}
+
+var activityWebService *restful.WebService
+
+func (ac ActivityController) Service() *restful.WebService {
+	return activityWebService
+}
+
+//Define routes
+func (ac ActivityController) Register(container *restful.Container) {
+	activityWebService = new(restful.WebService)
+	activityWebService.Filter(LogRequest).
+		Filter(AuthUser).
+		ApiVersion(ApiVersion()).
+		Path(ac.usersUri()).
+		Doc("User activity in the wikis").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	activityWebService.Route(activityWebService.GET("/{user-id}/activity").To(ac.activity).
+		Doc("Lists what a User has been doing in the wikis").
+		Operation("activity").
+		Param(activityWebService.PathParameter("user-id", "User Name").DataType("string")).
+		Param(activityWebService.QueryParameter("pageNum", "Page Number").DataType("integer")).
+		Param(activityWebService.QueryParameter("numPerPage", "Number of records to return").DataType("integer")).
+		Writes(ActivityResponse{}))
+
+	container.Add(activityWebService)
+}
+
+//List a User's pages, comments and files across the wikis
+func (ac ActivityController) activity(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	userId := request.PathParameter("user-id")
+	pageNum, numPerPage, err := changesPaging(request)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	activity, err := new(ChangesManager).User(userId, pageNum, numPerPage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(ActivityResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: ac.usersUri() + "/" + userId + "/activity{?pageNum,numPerPage}",
+				Method: "GET", Templated: true},
+		},
+		PageNum:  pageNum,
+		Activity: activity,
+	})
+}
@@ -0,0 +1,193 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"github.com/rhinoman/couchdb-go"
+	"github.com/rhinoman/wikifeat/common/config"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"time"
+)
+
+//Lists the recent changes to wikis, and turns them into feeds
+type ChangesManager struct{}
+
+//Gets the recent changes to a wiki, newest first.
+//Changes to pages the current user can't see are left out.
+func (cm *ChangesManager) Wiki(wiki string, pageNum int, numPerPage int,
+	curUser *CurrentUserInfo) ([]wikit.Change, *WikiRecord, error) {
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).Read(wiki, &wr, curUser); err != nil {
+		return nil, nil, err
+	}
+	changes, err := cm.wikiChanges(wiki, &wr, curUser, pageNum*numPerPage,
+		func(theWiki *wikit.Wiki, batchNum int, batchSize int) (*wikit.ChangeViewResponse, error) {
+			return theWiki.GetRecentChanges(batchNum, batchSize)
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	return wikit.MergeChanges([][]wikit.Change{changes}, pageNum, numPerPage), &wr, nil
+}
+
+//Gets the recent changes to every wiki the current user can read,
+//newest first
+func (cm *ChangesManager) Site(pageNum int, numPerPage int,
+	curUser *CurrentUserInfo) ([]wikit.Change, error) {
+	return cm.allWikis(pageNum, numPerPage, curUser,
+		func(theWiki *wikit.Wiki, batchNum int, batchSize int) (*wikit.ChangeViewResponse, error) {
+			return theWiki.GetRecentChanges(batchNum, batchSize)
+		})
+}
+
+//Gets the pages a user created or edited, the comments they wrote
+//and the files they uploaded, newest first, across every wiki the
+//current user can read
+func (cm *ChangesManager) User(userName string, pageNum int, numPerPage int,
+	curUser *CurrentUserInfo) ([]wikit.Change, error) {
+	//Make sure the user exists
+	userDb := Connection.SelectDB(UserDbName, AdminAuth)
+	if _, err := userDb.Read(UserPrefix+userName, &User{}, nil); err != nil {
+		return nil, err
+	}
+	return cm.allWikis(pageNum, numPerPage, curUser,
+		func(theWiki *wikit.Wiki, batchNum int, batchSize int) (*wikit.ChangeViewResponse, error) {
+			return theWiki.GetUserActivity(userName, batchNum, batchSize)
+		})
+}
+
+//Merges the changes fetched from every wiki the current user can read.
+//The fetch function gets a page of a wiki's changes, newest first.
+func (cm *ChangesManager) allWikis(pageNum int, numPerPage int,
+	curUser *CurrentUserInfo,
+	fetch func(*wikit.Wiki, int, int) (*wikit.ChangeViewResponse, error)) ([]wikit.Change, error) {
+	wlr := WikiListResponse{}
+	if err := new(WikiManager).GetWikiList(1, 0, false, &wlr, curUser); err != nil {
+		return nil, err
+	}
+	//Each wiki's newest visible changes, up to the end of the requested page
+	limit := pageNum * numPerPage
+	lists := [][]wikit.Change{}
+	for _, row := range wlr.Rows {
+		changes, err := cm.wikiChanges(row.Id, &row.Value, curUser, limit, fetch)
+		if cErr, ok := err.(*couchdb.Error); ok &&
+			(cErr.StatusCode == 401 || cErr.StatusCode == 403) {
+			//Not a reader of this wiki
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		lists = append(lists, changes)
+	}
+	return wikit.MergeChanges(lists, pageNum, numPerPage), nil
+}
+
+//Gets a wiki's newest changes the current user can see, up to limit.
+//Changes are fetched in batches until enough of them are visible.
+func (cm *ChangesManager) wikiChanges(wiki string, wr *WikiRecord,
+	curUser *CurrentUserInfo, limit int,
+	fetch func(*wikit.Wiki, int, int) (*wikit.ChangeViewResponse, error)) ([]wikit.Change, error) {
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+	visible := func(restriction *wikit.Restriction) bool {
+		return canAccess(wiki, restriction, curUser)
+	}
+	changes := []wikit.Change{}
+	for batchNum := 1; len(changes) < limit; batchNum++ {
+		response, err := fetch(theWiki, batchNum, limit)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := theWiki.ResolveChanges(response.Rows, visible)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, batch...)
+		if len(response.Rows) < limit {
+			//No more changes
+			break
+		}
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	for i := range changes {
+		changes[i].Wiki = wiki
+		changes[i].WikiSlug = wr.Slug
+		changes[i].WikiName = wr.Name
+	}
+	return changes, nil
+}
+
+//Turns a list of changes into a feed.  With siteWide set, entry titles
+//name the wiki the change was made in.
+func (cm *ChangesManager) Feed(title string, link string, self string,
+	changes []wikit.Change, siteWide bool) *wikit.Feed {
+	siteUrl := config.Notifications.MainSiteUrl
+	feed := wikit.Feed{
+		Title:   title,
+		Link:    siteUrl + link,
+		Self:    siteUrl + self,
+		Updated: time.Now().UTC(),
+		Entries: []wikit.FeedEntry{},
+	}
+	if len(changes) > 0 {
+		feed.Updated = changes[0].Timestamp
+	}
+	for _, change := range changes {
+		entry := wikit.FeedEntry{
+			Id:      "urn:wikifeat:" + change.Wiki + ":" + change.DocumentId,
+			Title:   change.Title + " was " + changeAction(change.Type) + " by " + change.User,
+			Link:    siteUrl + "/app/wikis/" + change.WikiSlug,
+			Author:  change.User,
+			Updated: change.Timestamp,
+		}
+		if siteWide {
+			entry.Title = "[" + change.WikiName + "] " + entry.Title
+		}
+		if change.Type != wikit.ChangeDeleted {
+			entry.Link += "/pages/" + change.Slug
+		}
+		if change.RevertedFrom != "" {
+			entry.Summary = "Reverted to an earlier revision"
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return &feed
+}
+
+func changeAction(changeType string) string {
+	if changeType == wikit.ChangeCommented {
+		return "commented on"
+	}
+	return changeType
+}
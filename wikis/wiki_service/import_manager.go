@@ -0,0 +1,358 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"archive/zip"
+	"github.com/rhinoman/couchdb-go"
+	"github.com/rhinoman/go-slugification"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/common/services"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+//Imports archives of markdown documents into a wiki
+type ImportManager struct{}
+
+type ImportResult struct {
+	Pages  []wikit.AffectedPage `json:"pages"`  //Pages created
+	Files  []ImportedFile       `json:"files"`  //Images and other files uploaded
+	Failed []ImportFailure      `json:"failed"` //Pages and files that couldn't be imported
+}
+
+type ImportedFile struct {
+	Path   string `json:"path"`
+	FileId string `json:"fileId"`
+}
+
+type ImportFailure struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+//State of a single import
+type importer struct {
+	wiki     string
+	wikiSlug string
+	curUser  *CurrentUserInfo
+	archive  *wikit.ImportArchive
+	result   *ImportResult
+	slugs    map[string]string //Page path -> slug
+	fileUrls map[string]string //File path -> content url
+}
+
+//Imports a zip archive of markdown documents.
+//Pages are created beneath each other as laid out in the archive's
+//directories; files the pages link to are uploaded as File records
+//and relative links are rewritten to point to the new pages and files.
+//Pages that can't be created (e.g., because the slug is taken) are
+//reported in the result rather than stopping the import.
+func (im *ImportManager) Import(wiki string, zr *zip.Reader,
+	curUser *CurrentUserInfo) (*ImportResult, error) {
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).Read(wiki, &wr, curUser); err != nil {
+		return nil, err
+	}
+	archive, err := wikit.ReadImportArchive(zr)
+	if err != nil {
+		return nil, err
+	}
+	imp := importer{
+		wiki:     wiki,
+		wikiSlug: wr.Slug,
+		curUser:  curUser,
+		archive:  archive,
+		result: &ImportResult{
+			Pages:  []wikit.AffectedPage{},
+			Files:  []ImportedFile{},
+			Failed: []ImportFailure{},
+		},
+		slugs:    make(map[string]string),
+		fileUrls: make(map[string]string),
+	}
+	for _, name := range archive.TooLarge {
+		imp.fail(name, "Page is larger than "+
+			strconv.Itoa(wikit.MaxImportPageSize)+" bytes")
+	}
+	imp.run()
+	return imp.result, nil
+}
+
+func (imp *importer) run() {
+	pm := new(PageManager)
+	//Work out the slugs up front, so pages can link to
+	//pages imported after them
+	slugPaths := make(map[string]string)
+	for _, page := range imp.archive.Pages {
+		slug := slugification.Slugify(page.Title)
+		if other, ok := slugPaths[slug]; ok {
+			imp.fail(page.Path, "Duplicate page slug '"+slug+"', also used by "+other)
+			continue
+		}
+		slugPaths[slug] = page.Path
+		imp.slugs[page.Path] = slug
+	}
+	pageIds := make(map[string]string)
+	for _, ip := range imp.archive.Pages {
+		if _, ok := imp.slugs[ip.Path]; !ok {
+			continue
+		}
+		page := wikit.Page{
+			Title:   ip.Title,
+			Tags:    ip.Tags,
+			Content: wikit.PageContent{Raw: ip.Content},
+			//A page whose parent failed ends up at the top level
+			Parent: pageIds[ip.Parent],
+		}
+		if ip.Source != "" {
+			page.Content.Raw = wikit.RewriteImportLinks(ip.Content,
+				ip.Source, imp.resolve)
+		}
+		pageId := GenUuid()
+		if _, err := pm.importPage(imp.wiki, &page, pageId, imp.curUser); err != nil {
+			imp.fail(ip.Path, errorReason(err))
+			continue
+		}
+		pageIds[ip.Path] = pageId
+		imp.result.Pages = append(imp.result.Pages, wikit.AffectedPage{
+			Id:    pageId,
+			Title: page.Title,
+			Slug:  page.Slug,
+		})
+	}
+	imp.relink()
+}
+
+//Renders the pages linking to the imported pages again, now that
+//they all exist.  Each page is rendered once, however many of the
+//imported pages it links to.
+func (imp *importer) relink() {
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(imp.wiki), imp.curUser.Auth)
+	relink := []string{}
+	seen := make(map[string]bool)
+	for _, ap := range imp.result.Pages {
+		pageIds, err := theWiki.GetMissingLinkPages(imp.wiki, ap.Slug)
+		if err != nil {
+			log.Printf("Error finding links to page %v: %v", ap.Slug, err)
+			continue
+		}
+		for _, pageId := range pageIds {
+			if !seen[pageId] {
+				seen[pageId] = true
+				relink = append(relink, pageId)
+			}
+		}
+	}
+	relinkPages(imp.wiki, relink, imp.curUser)
+}
+
+type MediaWikiImportResult struct {
+	Pages []MediaWikiPageReport `json:"pages"`
+	Error string                `json:"error,omitempty"` //Set if the dump couldn't be read to the end
+}
+
+//What happened to a single page of a MediaWiki dump
+type MediaWikiPageReport struct {
+	Title       string   `json:"title"`
+	PageId      string   `json:"pageId,omitempty"`
+	Slug        string   `json:"slug,omitempty"`
+	Revisions   int      `json:"revisions"`
+	Unsupported []string `json:"unsupported"` //Wikitext that couldn't be converted
+	Error       string   `json:"error,omitempty"`
+}
+
+//Imports the articles of a MediaWiki XML export as top level pages.
+//Every revision in the dump is converted to markdown and kept in the
+//page history with its original editor and timestamp.  Pages outside
+//the main namespace and redirects are skipped.  Only wiki admins may
+//import a dump, as the history is recorded in other users' names.
+func (im *ImportManager) ImportMediaWiki(wiki string, dump io.Reader,
+	curUser *CurrentUserInfo) (*MediaWikiImportResult, error) {
+	if !isWikiAdmin(wiki, curUser) {
+		return nil, NotAdminError()
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+	result := &MediaWikiImportResult{Pages: []MediaWikiPageReport{}}
+	slugs := []string{}
+	err := wikit.ReadMediaWikiDump(dump, func(mwPage *wikit.MediaWikiPage) error {
+		title := strings.Replace(mwPage.Title, "_", " ", -1)
+		report, revisions := im.convertRevisions(wiki, title, mwPage, curUser)
+		if report.Error == "" {
+			pageId := GenUuid()
+			if _, err := theWiki.ImportRevisions(pageId, revisions); err != nil {
+				report.Error = errorReason(err)
+			} else {
+				report.PageId = pageId
+				report.Slug = slugification.Slugify(title)
+				slugs = append(slugs, report.Slug)
+			}
+		}
+		if len(report.Unsupported) > 0 {
+			log.Printf("MediaWiki import of %v: not converted: %v",
+				title, strings.Join(report.Unsupported, "; "))
+		}
+		result.Pages = append(result.Pages, *report)
+		return nil
+	})
+	if err != nil {
+		result.Error = err.Error()
+	}
+	//Links to the imported pages only resolve once they exist
+	for _, slug := range slugs {
+		relinkMissing(wiki, slug, curUser)
+	}
+	return result, nil
+}
+
+//Converts the revisions of a MediaWiki page to rendered wiki pages
+func (im *ImportManager) convertRevisions(wiki string, title string,
+	mwPage *wikit.MediaWikiPage, curUser *CurrentUserInfo) (*MediaWikiPageReport, []wikit.Page) {
+	pm := new(PageManager)
+	report := &MediaWikiPageReport{
+		Title:       title,
+		Revisions:   len(mwPage.Revisions),
+		Unsupported: []string{},
+	}
+	if mwPage.Namespace != 0 {
+		report.Error = "Namespace " + strconv.Itoa(mwPage.Namespace) + " not imported"
+		return report, nil
+	}
+	if len(mwPage.Revisions) == 0 {
+		report.Error = "No revisions"
+		return report, nil
+	}
+	noted := make(map[string]bool)
+	revisions := []wikit.Page{}
+	for i, mwRev := range mwPage.Revisions {
+		conv := wikit.WikitextToMarkdown(mwRev.Text)
+		if i == len(mwPage.Revisions)-1 && conv.Redirect != "" {
+			report.Error = "Redirect to '" + conv.Redirect + "' not imported"
+			return report, nil
+		}
+		page := wikit.Page{
+			Title:      title,
+			LastEditor: mwRev.Editor(),
+			Timestamp:  mwRev.Timestamp,
+			Tags:       conv.Tags,
+			Content:    wikit.PageContent{Raw: conv.Markdown},
+		}
+		pm.renderPage(wiki, &page, curUser)
+		revisions = append(revisions, page)
+		for _, construct := range conv.Unsupported {
+			if !noted[construct] {
+				noted[construct] = true
+				report.Unsupported = append(report.Unsupported, construct)
+			}
+		}
+	}
+	return report, revisions
+}
+
+//Finds the new location of a relative link target.
+//Links to pages become page urls; other files are uploaded
+//the first time they are linked to.
+func (imp *importer) resolve(target string) (string, bool) {
+	if page, ok := imp.archive.FindPage(target); ok {
+		slug, ok := imp.slugs[page.Path]
+		if !ok {
+			return "", false
+		}
+		return "/app/wikis/" + imp.wikiSlug + "/pages/" + slug, true
+	}
+	if fileUrl, ok := imp.fileUrls[target]; ok {
+		return fileUrl, fileUrl != ""
+	}
+	f, ok := imp.archive.Files[target]
+	if !ok {
+		return "", false
+	}
+	fileId, attName, err := imp.uploadFile(target, f)
+	if err != nil {
+		imp.fail(target, errorReason(err))
+		//Don't try again
+		imp.fileUrls[target] = ""
+		return "", false
+	}
+	imp.result.Files = append(imp.result.Files, ImportedFile{target, fileId})
+	fileUrl := services.ApiPrefix() + "/wikis/" + imp.wiki + "/files/" +
+		fileId + "/content?attName=" + url.QueryEscape(attName)
+	imp.fileUrls[target] = fileUrl
+	return fileUrl, true
+}
+
+//Stores a file from the archive as a File record with an attachment
+func (imp *importer) uploadFile(filePath string, f *zip.File) (string, string, error) {
+	fm := new(FileManager)
+	attName := path.Base(filePath)
+	attType := mime.TypeByExtension(path.Ext(attName))
+	if attType == "" {
+		attType = "application/octet-stream"
+	}
+	fileId := GenUuid()
+	file := wikit.File{
+		Name:        attName,
+		Description: "Imported from " + filePath,
+	}
+	rev, err := fm.SaveFileRecord(imp.wiki, &file, fileId, "", imp.curUser)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := f.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer content.Close()
+	_, err = fm.SaveFileAttachment(imp.wiki, fileId, rev, attName,
+		attType, content, imp.curUser)
+	if err != nil {
+		return "", "", err
+	}
+	return fileId, attName, nil
+}
+
+func (imp *importer) fail(path string, reason string) {
+	imp.result.Failed = append(imp.result.Failed, ImportFailure{path, reason})
+}
+
+func errorReason(err error) string {
+	if cErr, ok := err.(*couchdb.Error); ok {
+		return cErr.Reason
+	}
+	return err.Error()
+}
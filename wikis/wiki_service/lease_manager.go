@@ -0,0 +1,198 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"encoding/json"
+	etcd "github.com/coreos/etcd/client"
+	"github.com/rhinoman/couchdb-go"
+	"github.com/rhinoman/wikifeat/common/config"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/common/registry"
+	"github.com/rhinoman/wikifeat/common/util"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"golang.org/x/net/context"
+	"time"
+)
+
+//Manages advisory edit leases on pages.
+//Leases are stored in etcd with a TTL, so an abandoned lease
+//expires on its own.  Editors renew their lease while the page is open.
+type LeaseManager struct{}
+
+type EditLease struct {
+	WikiId    string    `json:"wikiId"`
+	PageId    string    `json:"pageId"`
+	User      string    `json:"user"`
+	Since     time.Time `json:"since"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+//Returned when another user holds the lease on a page
+type LeaseHeldError struct {
+	Lease *EditLease
+}
+
+func (e *LeaseHeldError) Error() string {
+	return "[Error]:409: Page is being edited by " + e.Lease.User
+}
+
+var leasesLocation = registry.EtcdPrefix + "/leases/"
+
+func leaseLocation(wiki string, pageId string) string {
+	return leasesLocation + wiki + "/" + pageId
+}
+
+func isWikiAdmin(wiki string, curUser *CurrentUserInfo) bool {
+	userRoles := curUser.User.Roles
+	return util.HasRole(userRoles, AdminRole(wikiDbString(wiki))) ||
+		util.HasRole(userRoles, AdminRole(MainDbName())) ||
+		util.HasRole(userRoles, MasterRole())
+}
+
+//Takes a lease on a page, or renews the current user's lease
+func (lm *LeaseManager) Acquire(wiki string, pageId string,
+	curUser *CurrentUserInfo) (*EditLease, error) {
+	if !isWikiAdmin(wiki, curUser) &&
+		!util.HasRole(curUser.User.Roles, WriteRole(wikiDbString(wiki))) {
+		return nil, &couchdb.Error{StatusCode: 403, Reason: "Not Authorized"}
+	}
+	//Make sure the page exists
+	if _, err := new(PageManager).Read(wiki, pageId,
+		&wikit.Page{}, curUser); err != nil {
+		return nil, err
+	}
+	location := leaseLocation(wiki, pageId)
+	ttl := time.Duration(config.Wikis.EditLeaseTimeout) * time.Second
+	now := time.Now().UTC()
+	lease := EditLease{
+		WikiId:    wiki,
+		PageId:    pageId,
+		User:      curUser.User.UserName,
+		Since:     now,
+		ExpiresAt: now.Add(ttl),
+	}
+	options := &etcd.SetOptions{TTL: ttl}
+	current, prevValue, err := lm.read(location)
+	if err == nil {
+		if current.User != lease.User {
+			return nil, &LeaseHeldError{Lease: current}
+		}
+		//Renewal; only replace the lease we read
+		lease.Since = current.Since
+		options.PrevValue = prevValue
+	} else if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+		options.PrevExist = etcd.PrevNoExist
+	} else {
+		return nil, err
+	}
+	leaseBytes, err := json.Marshal(lease)
+	if err != nil {
+		return nil, err
+	}
+	kapi := registry.GetEtcdKeyAPI()
+	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	_, err = kapi.Set(ctx, location, string(leaseBytes), options)
+	if isEtcdError(err, etcd.ErrorCodeNodeExist) ||
+		isEtcdError(err, etcd.ErrorCodeTestFailed) {
+		//Somebody got there first
+		if held, _, rErr := lm.read(location); rErr == nil {
+			if held.User == lease.User {
+				return held, nil
+			}
+			return nil, &LeaseHeldError{Lease: held}
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+//Reads the current lease on a page
+func (lm *LeaseManager) Read(wiki string, pageId string,
+	curUser *CurrentUserInfo) (*EditLease, error) {
+	//Only readers of the page may see who's editing it
+	if _, err := new(PageManager).Read(wiki, pageId,
+		&wikit.Page{}, curUser); err != nil {
+		return nil, err
+	}
+	lease, _, err := lm.read(leaseLocation(wiki, pageId))
+	if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+		return nil, NotFoundError()
+	}
+	return lease, err
+}
+
+//Releases a lease.  Wiki admins may break another user's lease.
+func (lm *LeaseManager) Release(wiki string, pageId string,
+	curUser *CurrentUserInfo) error {
+	location := leaseLocation(wiki, pageId)
+	lease, prevValue, err := lm.read(location)
+	if isEtcdError(err, etcd.ErrorCodeKeyNotFound) {
+		return NotFoundError()
+	} else if err != nil {
+		return err
+	}
+	if lease.User != curUser.User.UserName && !isWikiAdmin(wiki, curUser) {
+		return NotAdminError()
+	}
+	kapi := registry.GetEtcdKeyAPI()
+	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	_, err = kapi.Delete(ctx, location, &etcd.DeleteOptions{PrevValue: prevValue})
+	if isEtcdError(err, etcd.ErrorCodeKeyNotFound) ||
+		isEtcdError(err, etcd.ErrorCodeTestFailed) {
+		//Expired or renewed in the meantime
+		return &couchdb.Error{StatusCode: 409, Reason: "Lease has changed"}
+	}
+	return err
+}
+
+//Fetches a lease from etcd, along with its raw value
+func (lm *LeaseManager) read(location string) (*EditLease, string, error) {
+	kapi := registry.GetEtcdKeyAPI()
+	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	resp, err := kapi.Get(ctx, location, &etcd.GetOptions{Recursive: false})
+	if err != nil {
+		return nil, "", err
+	}
+	lease := EditLease{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), &lease); err != nil {
+		return nil, "", err
+	}
+	return &lease, resp.Node.Value, nil
+}
+
+func isEtcdError(err error, code int) bool {
+	eErr, ok := err.(etcd.Error)
+	return ok && eErr.Code == code
+}
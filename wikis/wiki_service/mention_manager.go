@@ -0,0 +1,136 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"log"
+)
+
+//Notifies users mentioned (as @user-name) in pages and comments
+type MentionManager struct{}
+
+//Most distinct users one page or comment may mention
+const maxMentions = 50
+
+//Links the @mentions of registered users in rendered html to their
+//profiles.  Returns the linked html and the names of the users mentioned.
+func linkMentions(htmlText string) (string, []string) {
+	names := wikit.FindMentions(htmlText)
+	if len(names) > maxMentions {
+		names = names[:maxMentions]
+	}
+	userDb := Connection.SelectDB(UserDbName, AdminAuth)
+	users := []string{}
+	for _, name := range names {
+		user := User{}
+		if _, err := userDb.Read(UserPrefix+name, &user, nil); err == nil {
+			users = append(users, name)
+		}
+	}
+	if len(users) == 0 {
+		return htmlText, nil
+	}
+	return wikit.LinkMentions(htmlText, users), users
+}
+
+//The mentions in current that weren't in previous
+func newMentions(previous []string, current []string) []string {
+	known := make(map[string]bool)
+	for _, name := range previous {
+		known[name] = true
+	}
+	added := []string{}
+	for _, name := range current {
+		if !known[name] {
+			added = append(added, name)
+		}
+	}
+	return added
+}
+
+//Emails the mentioned users who can read the page.  Where says what
+//the mention was made in ("the page", "a comment on") and the summary
+//gives its context.
+func (mm *MentionManager) Notify(wiki string, pageId string, mentioned []string,
+	where string, summary string, curUser *CurrentUserInfo) {
+	if len(mentioned) == 0 {
+		return
+	}
+	page := wikit.Page{}
+	if _, err := new(PageManager).Read(wiki, pageId, &page, curUser); err != nil {
+		log.Printf("Error reading page %v: %v", pageId, err)
+		return
+	}
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).Read(wiki, &wr, curUser); err != nil {
+		log.Printf("Error reading wiki %v: %v", wiki, err)
+		return
+	}
+	author := curUser.User.UserName
+	data := map[string]string{
+		"author":  author,
+		"where":   where,
+		"wiki":    wr.Name,
+		"page":    page.Title,
+		"summary": summary,
+		"uri":     "/app/wikis/" + wr.Slug + "/pages/" + page.Slug,
+	}
+	for _, name := range mentioned {
+		if name == author {
+			continue
+		}
+		//Only readers of the wiki (and page) hear about it
+		reader, err := readerOf(wiki, &page, name)
+		if err != nil {
+			log.Printf("Not notifying %v of mention on %v: %v", name, pageId, err)
+			continue
+		} else if reader.Public.Contact.Email == "" {
+			continue
+		}
+		nr := NotificationRequest{
+			To:      reader.Public.Contact.Email,
+			Subject: "[" + wr.Name + "] " + author + " mentioned you on " + page.Title,
+			Data:    map[string]string{"user": reader.Public.FirstName},
+		}
+		if nr.Data["user"] == "" {
+			nr.Data["user"] = name
+		}
+		for key, value := range data {
+			nr.Data[key] = value
+		}
+		if err := sendNotification("mentioned", &nr); err != nil {
+			log.Printf("Error notifying %v of mention on %v: %v", name, pageId, err)
+		}
+	}
+}
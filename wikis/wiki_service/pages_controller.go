@@ -44,8 +44,9 @@ import (
 
 type PagesController struct{}
 type PageResponse struct {
-	Links HatLinks   `json:"_links"`
-	Page  wikit.Page `json:"page"`
+	Links    HatLinks      `json:"_links"`
+	Page     wikit.Page    `json:"page"`
+	Redirect *SlugRedirect `json:"redirect,omitempty"`
 }
 
 type PageIndexItem struct {
@@ -82,11 +83,79 @@ type HistoryEntryResponse struct {
 }
 
 type HistoryEntry struct {
-	Timestamp   string `json:"timestamp"`
-	Editor      string `json:"editor"`
-	ContentSize int    `json:"contentSize"`
-	DocumentId  string `json:"documentId"`
-	DocumentRev string `json:"documentRev"`
+	Timestamp    string `json:"timestamp"`
+	Editor       string `json:"editor"`
+	ContentSize  int    `json:"contentSize"`
+	DocumentId   string `json:"documentId"`
+	DocumentRev  string `json:"documentRev"`
+	RevertedFrom string `json:"revertedFrom,omitempty"`
+}
+
+type PageDeleteResponse struct {
+	Success bool               `json:"success"`
+	Result  wikit.DeleteResult `json:"result"`
+}
+
+type DraftResponse struct {
+	Links HatLinks    `json:"_links"`
+	Draft wikit.Draft `json:"draft"`
+}
+
+type EditLeaseResponse struct {
+	Links HatLinks  `json:"_links"`
+	Lease EditLease `json:"lease"`
+}
+
+type OutlineResponse struct {
+	Links   HatLinks             `json:"_links"`
+	Outline []wikit.OutlineEntry `json:"outline"`
+}
+
+type SectionRequest struct {
+	Content string `json:"content"`
+}
+
+type SectionResponse struct {
+	Links   HatLinks      `json:"_links"`
+	Section wikit.Section `json:"section"`
+}
+
+type WatchRequest struct {
+	Subtree bool `json:"subtree"`
+}
+
+type WatchResponse struct {
+	Links HatLinks    `json:"_links"`
+	Watch wikit.Watch `json:"watch"`
+}
+
+type WatchIndexResponse struct {
+	Links   HatLinks      `json:"_links"`
+	Watches []wikit.Watch `json:"watches"`
+}
+
+type PageConflictResponse struct {
+	Links      HatLinks          `json:"_links"`
+	CurrentRev string            `json:"currentRev"`
+	Merge      wikit.MergeResult `json:"merge"`
+}
+
+type MoveRequest struct {
+	Parent string `json:"parent"`
+}
+
+type SubtreeResponse struct {
+	Links  HatLinks            `json:"_links"`
+	Result wikit.SubtreeResult `json:"result"`
+}
+
+type RevertRequest struct {
+	DocumentId string `json:"documentId"`
+}
+
+type PageDiffResponse struct {
+	Links HatLinks       `json:"_links"`
+	Diff  wikit.PageDiff `json:"diff"`
 }
 
 type CommentResponse struct {
@@ -105,6 +174,22 @@ type CommentIndexList struct {
 	List []CommentResponse `json:"ea:comment"`
 }
 
+type CommentThreadResponse struct {
+	Comment    CommentResponse   `json:"comment"`
+	ReplyCount int               `json:"replyCount"`
+	Replies    []CommentResponse `json:"replies"`
+}
+
+type CommentThreadIndexResponse struct {
+	Links     HatLinks          `json:"_links"`
+	TotalRows int               `json:"totalRows"`
+	Entries   CommentThreadList `json:"_embedded"`
+}
+
+type CommentThreadList struct {
+	List []CommentThreadResponse `json:"ea:thread"`
+}
+
 var pageUri = "/{wiki-id}/pages"
 
 //Define routes
@@ -123,6 +208,13 @@ func (pc PagesController) AddRoutes(ws *restful.WebService) {
 		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
 		Writes(PageIndexResponse{}))
 
+	ws.Route(ws.GET(pageUri + "/{page-id}/backlinks").To(pc.backlinks).
+		Doc("Get list of pages linking to this page").
+		Operation("backlinks").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(PageIndexResponse{}))
+
 	ws.Route(ws.GET(pageUri + "/{page-id}/breadcrumbs").To(pc.breadcrumbs).
 		Doc("Get a list of this page's ancestry.").
 		Operation("breadcrumbs").
@@ -153,6 +245,15 @@ func (pc PagesController) AddRoutes(ws *restful.WebService) {
 		Param(ws.QueryParameter("numPerPage", "Number of records to return").DataType("integer")).
 		Writes(HistoryResponse{}))
 
+	ws.Route(ws.GET(pageUri + "/{page-id}/diff").To(pc.diff).
+		Doc("Compares two revisions of a Page").
+		Operation("diff").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.QueryParameter("from", "Document id of the older revision").DataType("string")).
+		Param(ws.QueryParameter("to", "Document id of the newer revision, defaults to the current page").DataType("string")).
+		Writes(PageDiffResponse{}))
+
 	ws.Route(ws.GET("/slug/{wiki-slug}/pages/{page-slug}").To(pc.readBySlug).
 		Doc("Reads a Page by its slug").
 		Operation("readBySlug").
@@ -169,13 +270,154 @@ func (pc PagesController) AddRoutes(ws *restful.WebService) {
 		Reads(wikit.Page{}).
 		Writes(PageResponse{}))
 
+	ws.Route(ws.POST(pageUri + "/{page-id}/revert").To(pc.revert).
+		Doc("Reverts a Page to a historical revision").
+		Operation("revert").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Page revision").DataType("string")).
+		Reads(RevertRequest{}).
+		Writes(PageResponse{}))
+
+	ws.Route(ws.GET(pageUri + "/{page-id}/draft").To(pc.readDraft).
+		Doc("Reads the current user's draft of a Page").
+		Operation("readDraft").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(DraftResponse{}))
+
+	ws.Route(ws.PUT(pageUri + "/{page-id}/draft").To(pc.saveDraft).
+		Doc("Saves the current user's draft of a Page").
+		Operation("saveDraft").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Reads(wikit.Draft{}).
+		Writes(DraftResponse{}))
+
+	ws.Route(ws.DELETE(pageUri + "/{page-id}/draft").To(pc.discardDraft).
+		Doc("Discards the current user's draft of a Page").
+		Operation("discardDraft").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(BooleanResponse{}))
+
+	ws.Route(ws.POST(pageUri + "/{page-id}/draft/publish").To(pc.publishDraft).
+		Doc("Publishes the current user's draft of a Page").
+		Operation("publishDraft").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Page revision the draft started from, if it has no baseRev").DataType("string")).
+		Writes(PageResponse{}))
+
+	ws.Route(ws.GET(pageUri + "/{page-id}/lease").To(pc.readLease).
+		Doc("Reads the edit lease on a Page").
+		Operation("readLease").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(EditLeaseResponse{}))
+
+	ws.Route(ws.PUT(pageUri + "/{page-id}/lease").To(pc.acquireLease).
+		Doc("Takes or renews the edit lease on a Page").
+		Operation("acquireLease").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(EditLeaseResponse{}))
+
+	ws.Route(ws.DELETE(pageUri + "/{page-id}/lease").To(pc.releaseLease).
+		Doc("Releases (or, for wiki admins, breaks) the edit lease on a Page").
+		Operation("releaseLease").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(BooleanResponse{}))
+
+	ws.Route(ws.GET(pageUri + "/{page-id}/outline").To(pc.outline).
+		Doc("Gets the outline (headings and their anchors) of a Page").
+		Operation("outline").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(OutlineResponse{}))
+
+	ws.Route(ws.GET(pageUri + "/{page-id}/sections/{anchor}").To(pc.readSection).
+		Doc("Reads one heading-delimited section of a Page's markdown").
+		Operation("readSection").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.PathParameter("anchor", "Anchor of the section's heading").DataType("string")).
+		Writes(SectionResponse{}))
+
+	ws.Route(ws.PUT(pageUri + "/{page-id}/sections/{anchor}").To(pc.saveSection).
+		Doc("Replaces one section of a Page").
+		Operation("saveSection").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.PathParameter("anchor", "Anchor of the section's heading").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Page revision").DataType("string")).
+		Reads(SectionRequest{}).
+		Writes(PageResponse{}))
+
+	ws.Route(ws.GET(pageUri + "/{page-id}/watch").To(pc.readWatch).
+		Doc("Reads the current user's watch on a Page").
+		Operation("readWatch").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(WatchResponse{}))
+
+	ws.Route(ws.PUT(pageUri + "/{page-id}/watch").To(pc.watch).
+		Doc("Watches a Page, or a Page and its descendants").
+		Operation("watch").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Reads(WatchRequest{}).
+		Writes(WatchResponse{}))
+
+	ws.Route(ws.DELETE(pageUri + "/{page-id}/watch").To(pc.unwatch).
+		Doc("Stops watching a Page").
+		Operation("unwatch").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Writes(BooleanResponse{}))
+
+	ws.Route(ws.GET("/{wiki-id}/watches").To(pc.watchIndex).
+		Doc("Lists the current user's watches in a Wiki").
+		Operation("watchIndex").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Writes(WatchIndexResponse{}))
+
+	ws.Route(ws.POST(pageUri + "/{page-id}/move").To(pc.move).
+		Doc("Moves a Page beneath a new parent").
+		Operation("move").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Page revision").DataType("string")).
+		Reads(MoveRequest{}).
+		Writes(SubtreeResponse{}))
+
+	ws.Route(ws.PUT(pageUri + "/{page-id}/restriction").To(pc.setRestriction).
+		Doc("Restricts a Page (and optionally its descendants) to named users and roles").
+		Operation("setRestriction").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Page revision").DataType("string")).
+		Reads(wikit.Restriction{}).
+		Writes(SubtreeResponse{}))
+
+	ws.Route(ws.DELETE(pageUri + "/{page-id}/restriction").To(pc.removeRestriction).
+		Doc("Lifts a Page's restriction").
+		Operation("removeRestriction").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Page revision").DataType("string")).
+		Writes(SubtreeResponse{}))
+
 	ws.Route(ws.DELETE(pageUri + "/{page-id}").To(pc.del).
 		Doc("Deletes a Page").
 		Operation("del").
 		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
 		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
 		Param(ws.HeaderParameter("If-Match", "Page revision").DataType("string")).
-		Writes(BooleanResponse{}))
+		Param(ws.QueryParameter("mode", "'promote' (default) or 'recursive'").DataType("string")).
+		Param(ws.QueryParameter("dryRun", "List affected pages only").DataType("boolean")).
+		Writes(PageDeleteResponse{}))
 
 	ws.Route(ws.POST(pageUri + "/{page-id}/comments").To(pc.createComment).
 		Doc("Creates a Comment for this page").
@@ -185,6 +427,15 @@ func (pc PagesController) AddRoutes(ws *restful.WebService) {
 		Reads(wikit.Comment{}).
 		Writes(CommentResponse{}))
 
+	ws.Route(ws.GET(pageUri + "/{page-id}/comments/threads").To(pc.commentThreads).
+		Doc("Get the comments for this page as threads").
+		Operation("threads").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("page-id", "Page identifier").DataType("string")).
+		Param(ws.QueryParameter("pageNum", "Page number for pagination").DataType("integer")).
+		Param(ws.QueryParameter("numPerPage", "Number of threads to return").DataType("integer")).
+		Writes(CommentThreadIndexResponse{}))
+
 	ws.Route(ws.GET(pageUri + "/{page-id}/comments/{comment-id}").To(pc.readComment).
 		Doc("Reads a Comment").
 		Operation("read").
@@ -290,6 +541,28 @@ func (pc PagesController) childIndex(request *restful.Request,
 	response.WriteEntity(indexResponse)
 }
 
+//Get the pages linking to a page
+func (pc PagesController) backlinks(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	pIndex, err := new(PageManager).Backlinks(wikiId, pageId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	indexResponse := pc.getIndexResponse(wikiId, curUser, pIndex)
+	indexResponse.Links = GenRecordLinks(curUser.User.Roles,
+		"wiki_"+wikiId, pc.genPageUri(wikiId, pageId)+"/backlinks")
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(indexResponse)
+}
+
 //Get breadcrumbs
 func (pc PagesController) breadcrumbs(request *restful.Request,
 	response *restful.Response) {
@@ -396,6 +669,37 @@ func (pc PagesController) history(request *restful.Request,
 	response.WriteEntity(hr)
 }
 
+//Compare two revisions of a page
+func (pc PagesController) diff(request *restful.Request,
+	response *restful.Response) {
+
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	fromId := request.QueryParameter("from")
+	toId := request.QueryParameter("to")
+	if wikiId == "" || pageId == "" || fromId == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	diff, err := new(PageManager).Diff(wikiId, pageId, fromId, toId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	diffUri := pc.genPageUri(wikiId, pageId) + "/diff?from=" +
+		diff.From.DocumentId + "&to=" + diff.To.DocumentId
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(PageDiffResponse{
+		Links: HatLinks{Self: &HatLink{Href: diffUri, Method: "GET"}},
+		Diff:  *diff,
+	})
+}
+
 //Read a Page by its slug
 func (pc PagesController) readBySlug(request *restful.Request,
 	response *restful.Response) {
@@ -412,13 +716,15 @@ func (pc PagesController) readBySlug(request *restful.Request,
 		return
 	}
 	page := wikit.Page{}
-	wikiId, rev, err := new(PageManager).ReadBySlug(wikiSlug, pageSlug, &page, curUser)
+	wikiId, rev, redirect, err := new(PageManager).ReadBySlug(wikiSlug, pageSlug, &page, curUser)
 	if err != nil {
 		WriteError(err, response)
 		return
 	}
 	response.AddHeader("ETag", rev)
 	pr := pc.genRecordResponse(curUser, wikiId, page.Id, &page)
+	//Let the client know the slugs it used are out of date
+	pr.Redirect = redirect
 	SetAuth(response, curUser.Auth)
 	response.WriteEntity(pr)
 }
@@ -445,7 +751,10 @@ func (pc PagesController) update(request *restful.Request,
 		return
 	}
 	rev, err = new(PageManager).Save(wikiId, thePage, pageId, rev, curUser)
-	if err != nil {
+	if mErr, ok := err.(*MergeConflictError); ok {
+		pc.writeMergeConflict(curUser, wikiId, pageId, mErr, response)
+		return
+	} else if err != nil {
 		WriteError(err, response)
 		return
 	}
@@ -456,8 +765,8 @@ func (pc PagesController) update(request *restful.Request,
 
 }
 
-//Delete a Page
-func (pc PagesController) del(request *restful.Request,
+//Revert a Page to a historical revision
+func (pc PagesController) revert(request *restful.Request,
 	response *restful.Response) {
 	curUser := GetCurrentUser(request, response)
 	if curUser == nil {
@@ -471,18 +780,27 @@ func (pc PagesController) del(request *restful.Request,
 		WriteBadRequestError(response)
 		return
 	}
-	rev, err := new(PageManager).Delete(wikiId, pageId, rev, curUser)
+	rr := new(RevertRequest)
+	err := request.ReadEntity(rr)
+	if err != nil || rr.DocumentId == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	thePage := new(wikit.Page)
+	rev, err = new(PageManager).Revert(wikiId, thePage, pageId, rev,
+		rr.DocumentId, curUser)
 	if err != nil {
 		WriteError(err, response)
 		return
 	}
-	SetAuth(response, curUser.Auth)
-	response.WriteEntity(BooleanResponse{Success: true})
 	response.AddHeader("ETag", rev)
+	pr := pc.genRecordResponse(curUser, wikiId, pageId, thePage)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pr)
 }
 
-//Create a comment
-func (pc PagesController) createComment(request *restful.Request,
+//Read the current user's draft of a Page
+func (pc PagesController) readDraft(request *restful.Request,
 	response *restful.Response) {
 	curUser := GetCurrentUser(request, response)
 	if curUser == nil {
@@ -491,28 +809,19 @@ func (pc PagesController) createComment(request *restful.Request,
 	}
 	wikiId := request.PathParameter("wiki-id")
 	pageId := request.PathParameter("page-id")
-	theComment := new(wikit.Comment)
-	err := request.ReadEntity(theComment)
-	if err != nil {
-		WriteServerError(err, response)
-		return
-	}
-	commentId := GenUuid()
-	rev, err := new(PageManager).SaveComment(wikiId, pageId, theComment,
-		commentId, "", curUser)
+	theDraft := new(wikit.Draft)
+	rev, err := new(PageManager).ReadDraft(wikiId, pageId, theDraft, curUser)
 	if err != nil {
 		WriteError(err, response)
 		return
 	}
 	response.AddHeader("ETag", rev)
-	response.WriteHeader(http.StatusCreated)
-	cr := pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, theComment)
 	SetAuth(response, curUser.Auth)
-	response.WriteEntity(cr)
+	response.WriteEntity(pc.genDraftResponse(wikiId, pageId, theDraft))
 }
 
-//Read a comment
-func (pc PagesController) readComment(request *restful.Request,
+//Save the current user's draft of a Page
+func (pc PagesController) saveDraft(request *restful.Request,
 	response *restful.Response) {
 	curUser := GetCurrentUser(request, response)
 	if curUser == nil {
@@ -521,26 +830,23 @@ func (pc PagesController) readComment(request *restful.Request,
 	}
 	wikiId := request.PathParameter("wiki-id")
 	pageId := request.PathParameter("page-id")
-	commentId := request.PathParameter("comment-id")
-	if wikiId == "" || pageId == "" || commentId == "" {
+	theDraft := new(wikit.Draft)
+	if err := request.ReadEntity(theDraft); err != nil {
 		WriteBadRequestError(response)
 		return
 	}
-	comment := wikit.Comment{}
-	rev, err := new(PageManager).ReadComment(wikiId, commentId,
-		&comment, curUser)
+	rev, err := new(PageManager).SaveDraft(wikiId, pageId, theDraft, curUser)
 	if err != nil {
 		WriteError(err, response)
 		return
 	}
 	response.AddHeader("ETag", rev)
-	cr := pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, &comment)
 	SetAuth(response, curUser.Auth)
-	response.WriteEntity(cr)
+	response.WriteEntity(pc.genDraftResponse(wikiId, pageId, theDraft))
 }
 
-//Update a comment
-func (pc PagesController) updateComment(request *restful.Request,
+//Discard the current user's draft of a Page
+func (pc PagesController) discardDraft(request *restful.Request,
 	response *restful.Response) {
 	curUser := GetCurrentUser(request, response)
 	if curUser == nil {
@@ -549,39 +855,18 @@ func (pc PagesController) updateComment(request *restful.Request,
 	}
 	wikiId := request.PathParameter("wiki-id")
 	pageId := request.PathParameter("page-id")
-	commentId := request.PathParameter("comment-id")
-	rev := request.HeaderParameter("If-Match")
-	if wikiId == "" || pageId == "" || commentId == "" || rev == "" {
-		WriteBadRequestError(response)
-		return
-	}
-	theComment := new(wikit.Comment)
-	err := request.ReadEntity(theComment)
-	if err != nil {
-		WriteServerError(err, response)
-		return
-	}
-	pm := new(PageManager)
-	rev, err = pm.SaveComment(wikiId, pageId, theComment,
-		commentId, rev, curUser)
+	rev, err := new(PageManager).DiscardDraft(wikiId, pageId, curUser)
 	if err != nil {
 		WriteError(err, response)
 		return
 	}
-	response.AddHeader("ETag", rev)
-	readComment := wikit.Comment{}
-	cr := CommentResponse{}
-	if _, err = pm.ReadComment(wikiId, commentId, &readComment, curUser); err != nil {
-		cr = pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, theComment)
-	} else {
-		cr = pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, &readComment)
-	}
 	SetAuth(response, curUser.Auth)
-	response.WriteEntity(cr)
+	response.AddHeader("ETag", rev)
+	response.WriteEntity(BooleanResponse{Success: true})
 }
 
-//Delete a comment
-func (pc PagesController) delComment(request *restful.Request,
+//Publish the current user's draft of a Page
+func (pc PagesController) publishDraft(request *restful.Request,
 	response *restful.Response) {
 	curUser := GetCurrentUser(request, response)
 	if curUser == nil {
@@ -590,24 +875,43 @@ func (pc PagesController) delComment(request *restful.Request,
 	}
 	wikiId := request.PathParameter("wiki-id")
 	pageId := request.PathParameter("page-id")
-	commentId := request.PathParameter("comment-id")
-	if wikiId == "" || pageId == "" || commentId == "" {
+	rev := request.HeaderParameter("If-Match")
+	if wikiId == "" || pageId == "" {
 		WriteBadRequestError(response)
 		return
 	}
-	rev, err := new(PageManager).DeleteComment(wikiId, commentId, curUser)
-	if err != nil {
+	thePage := new(wikit.Page)
+	rev, err := new(PageManager).PublishDraft(wikiId, pageId, rev,
+		thePage, curUser)
+	if mErr, ok := err.(*MergeConflictError); ok {
+		pc.writeMergeConflict(curUser, wikiId, pageId, mErr, response)
+		return
+	} else if err != nil {
 		WriteError(err, response)
 		return
 	}
-	SetAuth(response, curUser.Auth)
-	response.WriteEntity(BooleanResponse{Success: true})
 	response.AddHeader("ETag", rev)
+	pr := pc.genRecordResponse(curUser, wikiId, pageId, thePage)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pr)
+}
 
+func (pc PagesController) genDraftResponse(wikiId string, pageId string,
+	draft *wikit.Draft) DraftResponse {
+	uri := pc.genPageUri(wikiId, pageId) + "/draft"
+	return DraftResponse{
+		Links: HatLinks{
+			Self:   &HatLink{Href: uri, Method: "GET"},
+			Create: &HatLink{Href: uri + "/publish", Method: "POST"},
+			Update: &HatLink{Href: uri, Method: "PUT"},
+			Delete: &HatLink{Href: uri, Method: "DELETE"},
+		},
+		Draft: *draft,
+	}
 }
 
-//Gets all comments for a page
-func (pc PagesController) commentIndex(request *restful.Request,
+//Read the edit lease on a Page
+func (pc PagesController) readLease(request *restful.Request,
 	response *restful.Response) {
 	curUser := GetCurrentUser(request, response)
 	if curUser == nil {
@@ -616,28 +920,583 @@ func (pc PagesController) commentIndex(request *restful.Request,
 	}
 	wikiId := request.PathParameter("wiki-id")
 	pageId := request.PathParameter("page-id")
-	numPerPage, err := strconv.Atoi(request.QueryParameter("numPerPage"))
-	if err != nil {
-		numPerPage = 50
-	}
-	pageNum, err := strconv.Atoi(request.QueryParameter("pageNum"))
+	lease, err := new(LeaseManager).Read(wikiId, pageId, curUser)
 	if err != nil {
-		pageNum = 1
+		WriteError(err, response)
+		return
 	}
-	if wikiId == "" || pageId == "" {
-		WriteBadRequestError(response)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pc.genLeaseResponse(curUser, wikiId, pageId, lease))
+}
+
+//Take or renew the edit lease on a Page
+func (pc PagesController) acquireLease(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
 		return
 	}
-	cList, err := new(PageManager).GetComments(wikiId, pageId, pageNum, numPerPage, curUser)
-	if err != nil {
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	lease, err := new(LeaseManager).Acquire(wikiId, pageId, curUser)
+	if lErr, ok := err.(*LeaseHeldError); ok {
+		//Tell the client who holds the lease
+		SetAuth(response, curUser.Auth)
+		response.WriteHeader(http.StatusConflict)
+		response.WriteEntity(pc.genLeaseResponse(curUser, wikiId, pageId,
+			lErr.Lease))
+		return
+	} else if err != nil {
 		WriteError(err, response)
 		return
 	}
 	SetAuth(response, curUser.Auth)
-	cr := pc.genCommentIndexResponse(curUser, wikiId, pageId, cList)
+	response.WriteEntity(pc.genLeaseResponse(curUser, wikiId, pageId, lease))
+}
+
+//Release the edit lease on a Page
+func (pc PagesController) releaseLease(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	err := new(LeaseManager).Release(wikiId, pageId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(BooleanResponse{Success: true})
+}
+
+func (pc PagesController) genLeaseResponse(curUser *CurrentUserInfo,
+	wikiId string, pageId string, lease *EditLease) EditLeaseResponse {
+	uri := pc.genPageUri(wikiId, pageId) + "/lease"
+	links := HatLinks{
+		Self: &HatLink{Href: uri, Method: "GET"},
+	}
+	if lease.User == curUser.User.UserName || isWikiAdmin(wikiId, curUser) {
+		links.Delete = &HatLink{Href: uri, Method: "DELETE"}
+	}
+	if lease.User == curUser.User.UserName {
+		links.Update = &HatLink{Href: uri, Method: "PUT"}
+	}
+	return EditLeaseResponse{
+		Links: links,
+		Lease: *lease,
+	}
+}
+
+//Get the outline of a Page
+func (pc PagesController) outline(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	outline, err := new(PageManager).GetOutline(wikiId, pageId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(OutlineResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: pc.genPageUri(wikiId, pageId) + "/outline", Method: "GET"},
+		},
+		Outline: outline,
+	})
+}
+
+//Gives the client what it needs to resolve a conflicting edit
+func (pc PagesController) writeMergeConflict(curUser *CurrentUserInfo,
+	wikiId string, pageId string, mErr *MergeConflictError,
+	response *restful.Response) {
+	SetAuth(response, curUser.Auth)
+	response.WriteHeader(http.StatusConflict)
+	response.WriteEntity(PageConflictResponse{
+		Links: GenRecordLinks(curUser.User.Roles, "wiki_"+wikiId,
+			pc.genPageUri(wikiId, pageId)),
+		CurrentRev: mErr.CurrentRev,
+		Merge:      *mErr.Result,
+	})
+}
+
+//Read a section of a Page
+func (pc PagesController) readSection(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	anchor := request.PathParameter("anchor")
+	rev, section, err := new(PageManager).ReadSection(wikiId, pageId, anchor, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	uri := pc.genPageUri(wikiId, pageId) + "/sections/" + anchor
+	response.AddHeader("ETag", rev)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(SectionResponse{
+		Links: HatLinks{
+			Self:   &HatLink{Href: uri, Method: "GET"},
+			Update: &HatLink{Href: uri, Method: "PUT"},
+		},
+		Section: *section,
+	})
+}
+
+//Replace a section of a Page
+func (pc PagesController) saveSection(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	anchor := request.PathParameter("anchor")
+	rev := request.HeaderParameter("If-Match")
+	if wikiId == "" || pageId == "" || rev == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	sr := SectionRequest{}
+	if err := request.ReadEntity(&sr); err != nil {
+		WriteServerError(err, response)
+		return
+	}
+	page := wikit.Page{}
+	rev, err := new(PageManager).SaveSection(wikiId, pageId, rev, anchor,
+		sr.Content, &page, curUser)
+	if mErr, ok := err.(*MergeConflictError); ok {
+		pc.writeMergeConflict(curUser, wikiId, pageId, mErr, response)
+		return
+	} else if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	pr := pc.genRecordResponse(curUser, wikiId, pageId, &page)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pr)
+}
+
+//Read the current user's watch on a Page
+func (pc PagesController) readWatch(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	watch, err := new(WatchManager).Read(wikiId, pageId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pc.genWatchResponse(wikiId, pageId, watch))
+}
+
+//Watch a Page
+func (pc PagesController) watch(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	wr := WatchRequest{}
+	//An empty body watches just the page
+	if request.Request.ContentLength != 0 {
+		if err := request.ReadEntity(&wr); err != nil {
+			WriteBadRequestError(response)
+			return
+		}
+	}
+	watch, err := new(WatchManager).Watch(wikiId, pageId, wr.Subtree, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pc.genWatchResponse(wikiId, pageId, watch))
+}
+
+//Stop watching a Page
+func (pc PagesController) unwatch(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	err := new(WatchManager).Unwatch(wikiId, pageId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(BooleanResponse{Success: true})
+}
+
+//List the current user's watches in a Wiki
+func (pc PagesController) watchIndex(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	watches, err := new(WatchManager).Index(wikiId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(WatchIndexResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: ApiPrefix() + "/wikis/" + wikiId + "/watches", Method: "GET"},
+		},
+		Watches: watches,
+	})
+}
+
+func (pc PagesController) genWatchResponse(wikiId string, pageId string,
+	watch *wikit.Watch) WatchResponse {
+	uri := pc.genPageUri(wikiId, pageId) + "/watch"
+	return WatchResponse{
+		Links: HatLinks{
+			Self:   &HatLink{Href: uri, Method: "GET"},
+			Update: &HatLink{Href: uri, Method: "PUT"},
+			Delete: &HatLink{Href: uri, Method: "DELETE"},
+		},
+		Watch: *watch,
+	}
+}
+
+//Move a Page to a new parent
+func (pc PagesController) move(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	rev := request.HeaderParameter("If-Match")
+	if wikiId == "" || pageId == "" || rev == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	mr := new(MoveRequest)
+	if err := request.ReadEntity(mr); err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	rev, result, err := new(PageManager).Move(wikiId, pageId, rev,
+		mr.Parent, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(SubtreeResponse{
+		Links: GenRecordLinks(curUser.User.Roles, "wiki_"+wikiId,
+			pc.genPageUri(wikiId, pageId)),
+		Result: *result,
+	})
+}
+
+//Restrict a Page to named users and roles
+func (pc PagesController) setRestriction(request *restful.Request,
+	response *restful.Response) {
+	restriction := new(wikit.Restriction)
+	if err := request.ReadEntity(restriction); err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	pc.writeRestriction(request, response, restriction)
+}
+
+//Lift a Page's restriction
+func (pc PagesController) removeRestriction(request *restful.Request,
+	response *restful.Response) {
+	pc.writeRestriction(request, response, nil)
+}
+
+func (pc PagesController) writeRestriction(request *restful.Request,
+	response *restful.Response, restriction *wikit.Restriction) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	rev := request.HeaderParameter("If-Match")
+	if wikiId == "" || pageId == "" || rev == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	rev, result, err := new(RestrictionManager).Set(wikiId, pageId, rev,
+		restriction, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(SubtreeResponse{
+		Links: GenRecordLinks(curUser.User.Roles, "wiki_"+wikiId,
+			pc.genPageUri(wikiId, pageId)),
+		Result: *result,
+	})
+}
+
+//Delete a Page
+func (pc PagesController) del(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	rev := request.HeaderParameter("If-Match")
+	mode := request.QueryParameter("mode")
+	dryRun := request.QueryParameter("dryRun") == "true"
+	if wikiId == "" || pageId == "" || (rev == "" && !dryRun) {
+		WriteBadRequestError(response)
+		return
+	}
+	rev, result, err := new(PageManager).Delete(wikiId, pageId, rev,
+		mode, dryRun, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.AddHeader("ETag", rev)
+	response.WriteEntity(PageDeleteResponse{
+		Success: dryRun || rev != "",
+		Result:  *result,
+	})
+}
+
+//Create a comment
+func (pc PagesController) createComment(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	theComment := new(wikit.Comment)
+	err := request.ReadEntity(theComment)
+	if err != nil {
+		WriteServerError(err, response)
+		return
+	}
+	commentId := GenUuid()
+	rev, err := new(PageManager).SaveComment(wikiId, pageId, theComment,
+		commentId, "", curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	response.WriteHeader(http.StatusCreated)
+	cr := pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, theComment)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(cr)
+}
+
+//Read a comment
+func (pc PagesController) readComment(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	commentId := request.PathParameter("comment-id")
+	if wikiId == "" || pageId == "" || commentId == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	comment := wikit.Comment{}
+	rev, err := new(PageManager).ReadComment(wikiId, commentId,
+		&comment, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	cr := pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, &comment)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(cr)
+}
+
+//Update a comment
+func (pc PagesController) updateComment(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	commentId := request.PathParameter("comment-id")
+	rev := request.HeaderParameter("If-Match")
+	if wikiId == "" || pageId == "" || commentId == "" || rev == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	theComment := new(wikit.Comment)
+	err := request.ReadEntity(theComment)
+	if err != nil {
+		WriteServerError(err, response)
+		return
+	}
+	pm := new(PageManager)
+	rev, err = pm.SaveComment(wikiId, pageId, theComment,
+		commentId, rev, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	readComment := wikit.Comment{}
+	cr := CommentResponse{}
+	if _, err = pm.ReadComment(wikiId, commentId, &readComment, curUser); err != nil {
+		cr = pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, theComment)
+	} else {
+		cr = pc.genCommentRecordResponse(curUser, wikiId, pageId, commentId, &readComment)
+	}
+	SetAuth(response, curUser.Auth)
 	response.WriteEntity(cr)
 }
 
+//Delete a comment
+func (pc PagesController) delComment(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	commentId := request.PathParameter("comment-id")
+	if wikiId == "" || pageId == "" || commentId == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	rev, err := new(PageManager).DeleteComment(wikiId, commentId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(BooleanResponse{Success: true})
+	response.AddHeader("ETag", rev)
+
+}
+
+//Gets all comments for a page
+func (pc PagesController) commentIndex(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	numPerPage, err := strconv.Atoi(request.QueryParameter("numPerPage"))
+	if err != nil {
+		numPerPage = 50
+	}
+	pageNum, err := strconv.Atoi(request.QueryParameter("pageNum"))
+	if err != nil {
+		pageNum = 1
+	}
+	if wikiId == "" || pageId == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	cList, err := new(PageManager).GetComments(wikiId, pageId, pageNum, numPerPage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	cr := pc.genCommentIndexResponse(curUser, wikiId, pageId, cList)
+	response.WriteEntity(cr)
+}
+
+//Gets the comments for a page as threads
+func (pc PagesController) commentThreads(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageId := request.PathParameter("page-id")
+	numPerPage, err := strconv.Atoi(request.QueryParameter("numPerPage"))
+	if err != nil {
+		numPerPage = 20
+	}
+	pageNum, err := strconv.Atoi(request.QueryParameter("pageNum"))
+	if err != nil {
+		pageNum = 1
+	}
+	if wikiId == "" || pageId == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	threads, err := new(PageManager).GetCommentThreads(wikiId, pageId,
+		pageNum, numPerPage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pc.genCommentThreadResponse(curUser, wikiId, pageId, threads))
+}
+
 func (pc PagesController) genRecordResponse(curUser *CurrentUserInfo,
 	wikiId string, pageId string, page *wikit.Page) PageResponse {
 	page.Id = pageId
@@ -709,6 +1568,31 @@ func (pc PagesController) genCommentIndexResponse(curUser *CurrentUserInfo,
 	}
 }
 
+func (pc PagesController) genCommentThreadResponse(curUser *CurrentUserInfo,
+	wikiId string, pageId string, threads *wikit.CommentThreadList) CommentThreadIndexResponse {
+	entries := []CommentThreadResponse{}
+	for _, thread := range threads.Threads {
+		replies := []CommentResponse{}
+		for i := range thread.Replies {
+			replies = append(replies, pc.genCommentRecordResponse(curUser,
+				wikiId, pageId, thread.Replies[i].Id, &thread.Replies[i]))
+		}
+		entries = append(entries, CommentThreadResponse{
+			Comment: pc.genCommentRecordResponse(curUser, wikiId, pageId,
+				thread.Comment.Id, &thread.Comment),
+			ReplyCount: thread.ReplyCount,
+			Replies:    replies,
+		})
+	}
+	return CommentThreadIndexResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: pc.genPageUri(wikiId, pageId) + "/comments/threads", Method: "GET"},
+		},
+		TotalRows: threads.TotalRows,
+		Entries:   CommentThreadList{List: entries},
+	}
+}
+
 //This is gnarly
 func (pc PagesController) genHistoryResponse(curUser *CurrentUserInfo,
 	wikiId string, pageId string, history *wikit.HistoryViewResponse) HistoryResponse {
@@ -724,11 +1608,12 @@ func (pc PagesController) genHistoryResponse(curUser *CurrentUserInfo,
 				Self: &HatLink{Href: pc.genPageUri(wikiId, he.Id), Method: "GET"},
 			},
 			HistoryEntry: HistoryEntry{
-				Timestamp:   he.Key[1],
-				Editor:      values.Editor,
-				ContentSize: values.ContentSize,
-				DocumentId:  values.DocumentId,
-				DocumentRev: values.DocumentRev,
+				Timestamp:    he.Key[1],
+				Editor:       values.Editor,
+				ContentSize:  values.ContentSize,
+				DocumentId:   values.DocumentId,
+				DocumentRev:  values.DocumentRev,
+				RevertedFrom: values.RevertedFrom,
 			},
 		})
 	}
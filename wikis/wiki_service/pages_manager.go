@@ -33,12 +33,14 @@ package wiki_service
 import (
 	"errors"
 	"github.com/microcosm-cc/bluemonday"
+	"github.com/rhinoman/couchdb-go"
 	"github.com/rhinoman/go-commonmark"
 	. "github.com/rhinoman/wikifeat/common/database"
 	. "github.com/rhinoman/wikifeat/common/entities"
 	"github.com/rhinoman/wikifeat/common/util"
 	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
 	"log"
+	"reflect"
 	"regexp"
 )
 
@@ -51,6 +53,13 @@ type Breadcrumb struct {
 	Parent string `json:"parent"`
 }
 
+//Tells a client that a page was found under slugs it no longer has
+type SlugRedirect struct {
+	From     string `json:"from"`
+	WikiSlug string `json:"wikiSlug"`
+	PageSlug string `json:"pageSlug,omitempty"`
+}
+
 func wikiDbString(wikiId string) string {
 	return "wiki_" + wikiId
 }
@@ -60,15 +69,41 @@ func (pm *PageManager) Index(wiki string,
 	curUser *CurrentUserInfo) (wikit.PageIndex, error) {
 	auth := curUser.Auth
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
-	return theWiki.GetPageIndex()
+	index, err := theWiki.GetPageIndex()
+	if err != nil {
+		return nil, err
+	}
+	return filterRestricted(wiki, index, curUser), nil
 }
 
 //Gets a list of child pages for a given document
 func (pm *PageManager) ChildIndex(wiki string, pageId string,
 	curUser *CurrentUserInfo) (wikit.PageIndex, error) {
 	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	index, err := theWiki.GetChildPageIndex(pageId)
+	if err != nil {
+		return nil, err
+	}
+	return filterRestricted(wiki, index, curUser), nil
+}
+
+//Gets a list of pages linking to this page
+func (pm *PageManager) Backlinks(wiki string, pageId string,
+	curUser *CurrentUserInfo) (wikit.PageIndex, error) {
+	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
-	return theWiki.GetChildPageIndex(pageId)
+	index, err := theWiki.GetBacklinks(pageId)
+	if err != nil {
+		return nil, err
+	}
+	return filterRestricted(wiki, index, curUser), nil
 }
 
 //Gets a list of breadcrumbs for the current page
@@ -93,6 +128,10 @@ func (pm *PageManager) GetBreadcrumbs(wiki string, pageId string,
 		rows := append(response.Rows, currentPageRow)
 		for _, row := range rows {
 			theDoc := row.Doc
+			//Leave out restricted ancestors
+			if !canAccess(wiki, theDoc.Restriction, curUser) {
+				continue
+			}
 			parent := ""
 			if len(theDoc.Lineage) >= 2 {
 				parent = theDoc.Lineage[len(theDoc.Lineage)-2]
@@ -115,18 +154,259 @@ func (pm *PageManager) GetBreadcrumbs(wiki string, pageId string,
 //Creates or Updates a page
 //Returns the revision number, if successful
 func (pm *PageManager) Save(wiki string, page *wikit.Page,
+	pageId string, pageRev string, curUser *CurrentUserInfo) (string, error) {
+	//Only a revert may mark a revision as reverted
+	page.RevertedFrom = ""
+	//Restrictions are set on their own, by admins
+	page.Restriction = nil
+	//The page, or the parent of a new page, must be visible to this user
+	previous := wikit.Page{}
+	if pageRev != "" {
+		if _, err := pm.Read(wiki, pageId, &previous, curUser); err != nil {
+			return "", err
+		}
+		//Someone may have saved the page since this edit began
+		var err error
+		if pageRev, err = pm.mergeStaleEdit(wiki, page, pageId,
+			pageRev, curUser); err != nil {
+			return "", err
+		}
+	} else if page.Parent != "" {
+		if err := pm.checkPageAccess(wiki, page.Parent, curUser); err != nil {
+			return "", err
+		}
+	}
+	action := "edited"
+	if pageRev == "" {
+		action = "created"
+	}
+	rev, err := pm.savePage(wiki, page, pageId, pageRev, curUser)
+	if err != nil {
+		return "", err
+	}
+	pm.pageSaved(wiki, &previous, page, pageId, action, curUser)
+	return rev, nil
+}
+
+//Creates a page for an import.  Unlike Save, nobody is notified and
+//links to the page are left for the importer to update once it's done.
+func (pm *PageManager) importPage(wiki string, page *wikit.Page,
+	pageId string, curUser *CurrentUserInfo) (string, error) {
+	page.RevertedFrom = ""
+	page.Restriction = nil
+	return pm.savePage(wiki, page, pageId, "", curUser)
+}
+
+//Follows up on a saved page: relinks pages linking to its slug and
+//notifies the newly mentioned users and the page's watchers.
+//The action is how the page changed ("created", "edited", "reverted").
+func (pm *PageManager) pageSaved(wiki string, previous *wikit.Page,
+	page *wikit.Page, pageId string, action string, curUser *CurrentUserInfo) {
+	created := action == "created"
+	//Links to this page from other pages may resolve now
+	if created || previous.Slug != page.Slug {
+		go relinkMissing(wiki, page.Slug, curUser)
+	}
+	//Let anyone newly mentioned know
+	go new(MentionManager).Notify(wiki, pageId,
+		newMentions(previous.Mentions, page.Mentions), "the page",
+		excerpt(page.Content.Raw, commentExcerptLength), curUser)
+	//Let the page's watchers know
+	summary := "New page"
+	if !created {
+		summary = wikit.ChangeSummary(previous, page)
+	}
+	go new(WatchManager).PageChanged(wiki, pageId, action, summary, curUser)
+}
+
+//Returned when an edit of an out of date revision can't be merged
+type MergeConflictError struct {
+	CurrentRev string
+	Result     *wikit.MergeResult
+}
+
+func (e *MergeConflictError) Error() string {
+	return "[Error]:409: Edit conflicts with changes made since revision"
+}
+
+//If pageRev is out of date, merges the edit's content with the
+//changes saved since then.  Returns the revision to save against.
+func (pm *PageManager) mergeStaleEdit(wiki string, page *wikit.Page,
+	pageId string, pageRev string, curUser *CurrentUserInfo) (string, error) {
+	auth := curUser.Auth
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	current := wikit.Page{}
+	curRev, err := theWiki.ReadPage(pageId, &current)
+	if err != nil || curRev == pageRev {
+		//Nothing to merge, let the save sort it out
+		return pageRev, nil
+	}
+	base := wikit.Page{}
+	if err := theWiki.ReadPageAtRevision(pageId, pageRev, &base); err != nil {
+		return "", &couchdb.Error{
+			StatusCode: 409,
+			Reason:     "Page has changed and the edit's base revision is unavailable",
+		}
+	}
+	result := wikit.Merge3(base.Content.Raw, page.Content.Raw, current.Content.Raw)
+	if !result.Clean() {
+		return "", &MergeConflictError{CurrentRev: curRev, Result: result}
+	}
+	page.Content.Raw = result.Merged
+	//Keep the other changes to the title and tags, unless this edit made its own
+	if page.Title == base.Title {
+		page.Title = current.Title
+	}
+	if reflect.DeepEqual(wikit.NormalizeTags(page.Tags), base.Tags) {
+		page.Tags = current.Tags
+	}
+	//The page may have been moved in the meantime
+	if page.Parent == base.Parent && reflect.DeepEqual(page.Lineage, base.Lineage) {
+		page.Parent = current.Parent
+		page.Lineage = current.Lineage
+	}
+	return curRev, nil
+}
+
+//Reverts a page to a historical revision
+//The historical content is saved as a new revision of the page.
+//Returns the revision number, if successful
+func (pm *PageManager) Revert(wiki string, page *wikit.Page, pageId string,
+	pageRev string, historyId string, curUser *CurrentUserInfo) (string, error) {
+	auth := curUser.Auth
+	previous := wikit.Page{}
+	if _, err := pm.Read(wiki, pageId, &previous, curUser); err != nil {
+		return "", err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	if err := theWiki.PrepareRevert(pageId, historyId, page); err != nil {
+		return "", err
+	}
+	rev, err := pm.savePage(wiki, page, pageId, pageRev, curUser)
+	if err != nil {
+		return "", err
+	}
+	pm.pageSaved(wiki, &previous, page, pageId, "reverted", curUser)
+	return rev, nil
+}
+
+func (pm *PageManager) savePage(wiki string, page *wikit.Page,
 	pageId string, pageRev string, curUser *CurrentUserInfo) (string, error) {
 	auth := curUser.Auth
 	theUser := curUser.User
+	pm.renderPage(wiki, page, curUser)
+	//Store the thing, if you have the auth
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	return theWiki.SavePage(page, pageId, pageRev, theUser.UserName)
+}
+
+//Renders a page's markdown to html and collects its links
+func (pm *PageManager) renderPage(wiki string, page *wikit.Page,
+	curUser *CurrentUserInfo) {
 	//Read the content from the page
 	//parse the markdown to Html
 	out := make(chan string)
+	//Resolve [[wiki links]] before rendering
+	lr := newLinkResolver(wiki, curUser)
+	mdText, links := lr.resolve(page.Content.Raw)
+	page.Links = links
 	//Convert (Sanitized) Markdown to HTML
-	go processMarkdown(page.Content.Raw, out)
-	page.Content.Formatted = <-out
-	//Store the thing, if you have the auth
+	go processPageMarkdown(mdText, out)
+	page.Content.Formatted, page.Mentions = linkMentions(<-out)
+	page.Outline = wikit.ReadOutline(page.Content.Formatted)
+	//Pick up plain markdown links to other pages, too
+	page.Links = lr.resolveHrefs(page.Content.Formatted, page.Links)
+}
+
+//Gets the outline of a page: its headings and their anchors
+func (pm *PageManager) GetOutline(wiki string, pageId string,
+	curUser *CurrentUserInfo) ([]wikit.OutlineEntry, error) {
+	page := wikit.Page{}
+	if _, err := pm.Read(wiki, pageId, &page, curUser); err != nil {
+		return nil, err
+	}
+	if page.Outline == nil {
+		return []wikit.OutlineEntry{}, nil
+	}
+	return page.Outline, nil
+}
+
+//Reads one section of a page's markdown, by its heading's anchor
+//Returns the page revision and the section
+func (pm *PageManager) ReadSection(wiki string, pageId string, anchor string,
+	curUser *CurrentUserInfo) (string, *wikit.Section, error) {
+	page := wikit.Page{}
+	rev, err := pm.Read(wiki, pageId, &page, curUser)
+	if err != nil {
+		return "", nil, err
+	}
+	section, ok := wikit.FindSection(page.Content.Raw, anchor)
+	if !ok {
+		return "", nil, NotFoundError()
+	}
+	return rev, &section, nil
+}
+
+//Replaces one section of a page and saves the whole page.
+//If the page has changed since pageRev, the edit is merged with the
+//section's changes only, so edits elsewhere in the page never conflict.
+func (pm *PageManager) SaveSection(wiki string, pageId string, pageRev string,
+	anchor string, content string, page *wikit.Page,
+	curUser *CurrentUserInfo) (string, error) {
+	curRev, err := pm.Read(wiki, pageId, page, curUser)
+	if err != nil {
+		return "", err
+	} else if page.OwningPage != pageId {
+		return "", BadRequestError()
+	}
+	current, found := wikit.FindSection(page.Content.Raw, anchor)
+	if curRev != pageRev {
+		theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+		base := wikit.Page{}
+		if err := theWiki.ReadPageAtRevision(pageId, pageRev, &base); err != nil {
+			return "", &couchdb.Error{
+				StatusCode: 409,
+				Reason:     "Page has changed and the edit's base revision is unavailable",
+			}
+		}
+		baseSection, ok := wikit.FindSection(base.Content.Raw, anchor)
+		if !ok {
+			return "", NotFoundError()
+		} else if !found {
+			return "", &couchdb.Error{
+				StatusCode: 409,
+				Reason:     "Section has been renamed or removed since revision",
+			}
+		}
+		result := wikit.Merge3(baseSection.Content, content, current.Content)
+		if !result.Clean() {
+			return "", &MergeConflictError{CurrentRev: curRev, Result: result}
+		}
+		content = result.Merged
+	} else if !found {
+		return "", NotFoundError()
+	}
+	page.Content = wikit.PageContent{
+		Raw: wikit.ReplaceSection(page.Content.Raw, current, content),
+	}
+	return pm.Save(wiki, page, pageId, curRev, curUser)
+}
+
+//Moves a page beneath a new parent, rewriting the lineage of its subtree
+//Returns the page revision and a list of updated and failed descendants
+func (pm *PageManager) Move(wiki string, pageId string, pageRev string,
+	newParent string, curUser *CurrentUserInfo) (string, *wikit.SubtreeResult, error) {
+	auth := curUser.Auth
+	for _, id := range []string{pageId, newParent} {
+		if id == "" {
+			continue
+		}
+		if err := pm.checkPageAccess(wiki, id, curUser); err != nil {
+			return "", nil, err
+		}
+	}
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
-	return theWiki.SavePage(page, pageId, pageRev, theUser.UserName)
+	return theWiki.MovePage(pageId, pageRev, newParent)
 }
 
 //Read a page
@@ -135,93 +415,259 @@ func (pm *PageManager) Read(wiki string, pageId string,
 	page *wikit.Page, curUser *CurrentUserInfo) (string, error) {
 	auth := curUser.Auth
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
-	return theWiki.ReadPage(pageId, page)
+	rev, err := theWiki.ReadPage(pageId, page)
+	if err != nil {
+		return "", err
+	}
+	//History copies keep the restriction they were saved with,
+	//it's the current page's restriction that counts
+	restricted := page
+	if page.OwningPage != "" && page.OwningPage != pageId {
+		restricted = &wikit.Page{}
+		if _, err := theWiki.ReadPage(page.OwningPage, restricted); err != nil {
+			*page = wikit.Page{}
+			return "", err
+		}
+	}
+	if err := checkRestriction(wiki, restricted, curUser); err != nil {
+		*page = wikit.Page{}
+		return "", err
+	}
+	return rev, nil
+}
+
+//Checks that a page exists and the current user may see it
+func (pm *PageManager) checkPageAccess(wiki string, pageId string,
+	curUser *CurrentUserInfo) error {
+	_, err := pm.Read(wiki, pageId, &wikit.Page{}, curUser)
+	return err
 }
 
 // Read a page by its slug.
 // Assume the wiki Id passed in is a slug also
-// Returns the WikiId, the Page Rev, and an error
+// Returns the WikiId, the Page Rev, a redirect if either slug
+// has since changed, and an error
 func (pm *PageManager) ReadBySlug(wikiSlug string, pageSlug string,
-	page *wikit.Page, curUser *CurrentUserInfo) (string, string, error) {
+	page *wikit.Page, curUser *CurrentUserInfo) (string, string, *SlugRedirect, error) {
 	// Need to get the true wiki Id from the slug
-	auth := curUser.Auth
-	mainDbName := MainDbName()
-	mainDb := Connection.SelectDB(mainDbName, auth)
-	response := WikiSlugViewResponse{}
-	err := mainDb.GetView("wiki_query",
-		"getWikiBySlug",
-		&response,
-		wikit.SetKey(wikiSlug))
+	// (this follows the wiki's previous slugs, too)
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).ReadBySlug(wikiSlug, &wr, curUser); err != nil {
+		return "", "", nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wr.Id), curUser.Auth)
+	pageRev, err := theWiki.ReadPageBySlug(pageSlug, page)
 	if err != nil {
-		return "", "", err
+		//The page may have been renamed
+		if pRev, pErr := theWiki.ReadPageByPreviousSlug(pageSlug, page); pErr != nil {
+			return "", "", nil, err
+		} else {
+			pageRev = pRev
+		}
 	}
-	if len(response.Rows) > 0 {
-		wikiId := response.Rows[0].Id
-		theWiki := wikit.SelectWiki(Connection, wikiDbString(wikiId), auth)
-		pageRev, err := theWiki.ReadPageBySlug(pageSlug, page)
-		return wikiId, pageRev, err
-	} else {
-		return "", "", NotFoundError()
+	if err = checkRestriction(wr.Id, page, curUser); err != nil {
+		*page = wikit.Page{}
+		return "", "", nil, err
+	}
+	var redirect *SlugRedirect
+	if wr.Slug != wikiSlug || page.Slug != pageSlug {
+		redirect = &SlugRedirect{
+			From:     wikiSlug + "/" + pageSlug,
+			WikiSlug: wr.Slug,
+			PageSlug: page.Slug,
+		}
 	}
+	return wr.Id, pageRev, redirect, nil
 }
 
 //Delete a page.  Returns the revision, if successful
-func (pm *PageManager) Delete(wiki string, pageId string,
-	pageRev string, curUser *CurrentUserInfo) (string, error) {
+//The mode decides whether descendants are deleted or promoted to the
+//page's parent.  A dry run only lists the pages that would be affected.
+func (pm *PageManager) Delete(wiki string, pageId string, pageRev string,
+	mode string, dryRun bool, curUser *CurrentUserInfo) (string, *wikit.DeleteResult, error) {
 	auth := curUser.Auth
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	if mode == "" {
+		mode = wikit.DeletePromote
+	}
 	//Load the page
 	thePage := wikit.Page{}
 	if _, err := theWiki.ReadPage(pageId, &thePage); err != nil {
-		return "", err
+		return "", nil, err
 	} else if thePage.OwningPage != pageId {
 		//Thou shalt not delete historical revisions
-		return "", BadRequestError()
+		return "", nil, BadRequestError()
+	} else if err := checkRestriction(wiki, &thePage, curUser); err != nil {
+		return "", nil, err
+	}
+	plan, err := theWiki.PlanDelete(pageId, mode)
+	if err != nil {
+		return "", nil, err
+	}
+	//Restricted descendants would show up in the plan
+	if !isWikiAdmin(wiki, curUser) {
+		descendants, err := theWiki.GetDescendants(pageId)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, doc := range descendants {
+			if !canAccess(wiki, doc.Restriction, curUser) {
+				return "", nil, &couchdb.Error{
+					StatusCode: 403,
+					Reason:     "Page has restricted descendants",
+				}
+			}
+		}
 	}
-	//check if this is a 'home page'
+	if dryRun {
+		plan.DryRun = true
+		return "", plan, nil
+	}
+	//check if this is (or contains) a 'home page'
 	wm := WikiManager{}
 	wr := WikiRecord{}
 	if wRev, err := wm.Read(wiki, &wr, curUser); err != nil {
-		return "", err
-	} else if wr.HomePageId == pageId {
-		//This is a home page, so clear the Wiki Record's home page Id
-		wr.HomePageId = ""
-		_, err = wm.Update(wiki, wRev, &wr, curUser)
-		if err != nil {
-			return "", err
+		return "", nil, err
+	} else {
+		for _, deleted := range plan.Deleted {
+			if wr.HomePageId != deleted.Id {
+				continue
+			}
+			//This is a home page, so clear the Wiki Record's home page Id
+			wr.HomePageId = ""
+			_, err = wm.Update(wiki, wRev, &wr, curUser)
+			if err != nil {
+				return "", nil, err
+			}
+			break
 		}
 	}
-	return theWiki.DeletePage(pageId, pageRev)
+	return theWiki.DeletePageTree(pageId, pageRev, mode, curUser.User.UserName)
+}
+
+//Saves the current user's draft of a page
+func (pm *PageManager) SaveDraft(wiki string, pageId string,
+	draft *wikit.Draft, curUser *CurrentUserInfo) (string, error) {
+	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return "", err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	return theWiki.SaveDraft(draft, pageId, curUser.User.UserName)
+}
+
+//Reads the current user's draft of a page
+func (pm *PageManager) ReadDraft(wiki string, pageId string,
+	draft *wikit.Draft, curUser *CurrentUserInfo) (string, error) {
+	auth := curUser.Auth
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	return theWiki.ReadDraft(pageId, curUser.User.UserName, draft)
+}
+
+//Discards the current user's draft of a page
+func (pm *PageManager) DiscardDraft(wiki string, pageId string,
+	curUser *CurrentUserInfo) (string, error) {
+	auth := curUser.Auth
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	return theWiki.DeleteDraft(pageId, curUser.User.UserName)
+}
+
+//Publishes the current user's draft of a page.
+//The page is saved once, so exactly one history entry is created,
+//and the draft is discarded.  Changes saved since the draft's base
+//revision are merged with it; pageRev is only used as the base of
+//drafts that don't record one.
+func (pm *PageManager) PublishDraft(wiki string, pageId string,
+	pageRev string, page *wikit.Page, curUser *CurrentUserInfo) (string, error) {
+	draft := wikit.Draft{}
+	if _, err := pm.ReadDraft(wiki, pageId, &draft, curUser); err != nil {
+		return "", err
+	}
+	baseRev := draft.BaseRev
+	if baseRev == "" {
+		baseRev = pageRev
+	}
+	if baseRev == "" {
+		return "", BadRequestError()
+	}
+	if _, err := pm.Read(wiki, pageId, page, curUser); err != nil {
+		return "", err
+	} else if page.OwningPage != pageId {
+		return "", BadRequestError()
+	}
+	page.Title = draft.Title
+	page.Content = wikit.PageContent{Raw: draft.Content.Raw}
+	page.Tags = draft.Tags
+	rev, err := pm.Save(wiki, page, pageId, baseRev, curUser)
+	if err != nil {
+		return "", err
+	}
+	if _, err := pm.DiscardDraft(wiki, pageId, curUser); err != nil {
+		log.Printf("Error discarding published draft of %v: %v", pageId, err)
+	}
+	return rev, nil
 }
 
 //Gets the history for this page
 func (pm *PageManager) GetHistory(wiki string, pageId string, pageNum int,
 	numPerPage int, curUser *CurrentUserInfo) (*wikit.HistoryViewResponse, error) {
 	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
 	return theWiki.GetHistory(pageId, pageNum, numPerPage)
 }
 
+//Compares two revisions of a page
+func (pm *PageManager) Diff(wiki string, pageId string, fromId string,
+	toId string, curUser *CurrentUserInfo) (*wikit.PageDiff, error) {
+	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	return theWiki.DiffPage(pageId, fromId, toId)
+}
+
 //Creates or updates a comment
 func (pm *PageManager) SaveComment(wiki string, pageId string, comment *wikit.Comment,
 	commentId string, commentRev string, curUser *CurrentUserInfo) (string, error) {
 	auth := curUser.Auth
 	theUser := curUser.User
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return "", err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
 	//First, if this is an update, check if this user can update the comment
+	previous := wikit.Comment{}
 	if commentRev != "" {
 		if cu := pm.allowedToUpdateComment(wiki, commentId, curUser); cu == false {
 			return "", errors.New("[Error]:403: Not Authorized")
 		}
+		if _, err := theWiki.ReadComment(commentId, &previous); err != nil {
+			return "", err
+		}
 	}
 	//Read the content from the comment
 	//parse the markdown to Html
 	out := make(chan string)
 	//Convert (Sanitized) Markdown to HTML
 	go processMarkdown(comment.Content.Raw, out)
-	comment.Content.Formatted = <-out
+	comment.Content.Formatted, comment.Mentions = linkMentions(<-out)
 	//Store it
-	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
-	return theWiki.SaveComment(comment, commentId, commentRev, pageId, theUser.UserName)
+	rev, err := theWiki.SaveComment(comment, commentId, commentRev, pageId, theUser.UserName)
+	if err != nil {
+		return "", err
+	}
+	go new(MentionManager).Notify(wiki, pageId,
+		newMentions(previous.Mentions, comment.Mentions), "a comment on",
+		excerpt(comment.Content.Raw, commentExcerptLength), curUser)
+	if commentRev == "" {
+		go new(WatchManager).PageChanged(wiki, pageId, "commented on",
+			excerpt(comment.Content.Raw, commentExcerptLength), curUser)
+	}
+	return rev, nil
 }
 
 //Read a comment
@@ -229,7 +675,16 @@ func (pm *PageManager) ReadComment(wiki string, commentId string,
 	comment *wikit.Comment, curUser *CurrentUserInfo) (string, error) {
 	auth := curUser.Auth
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
-	return theWiki.ReadComment(commentId, comment)
+	rev, err := theWiki.ReadComment(commentId, comment)
+	if err != nil {
+		return "", err
+	}
+	//Comments on restricted pages are hidden along with the page
+	if err := pm.checkPageAccess(wiki, comment.OwningPage, curUser); err != nil {
+		*comment = wikit.Comment{}
+		return "", err
+	}
+	return rev, nil
 }
 
 //Delete a comment.  Returns the revision if successful
@@ -278,12 +733,36 @@ func (pm *PageManager) GetComments(wiki string, pageId string,
 	pageNum int, numPerPage int,
 	curUser *CurrentUserInfo) (*wikit.CommentIndexViewResponse, error) {
 	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
 	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
 	return theWiki.GetCommentsForPage(pageId, pageNum, numPerPage)
 }
 
+//Gets the comments for a page as threads, paginated by top-level comment
+func (pm *PageManager) GetCommentThreads(wiki string, pageId string,
+	pageNum int, numPerPage int,
+	curUser *CurrentUserInfo) (*wikit.CommentThreadList, error) {
+	auth := curUser.Auth
+	if err := pm.checkPageAccess(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	return theWiki.GetCommentThreads(pageId, pageNum, numPerPage)
+}
+
 //Converts markdown text to html
 func processMarkdown(mdText string, out chan string) {
+	renderMarkdown(mdText, false, out)
+}
+
+//Converts page markdown to html, giving the headings anchors
+func processPageMarkdown(mdText string, out chan string) {
+	renderMarkdown(mdText, true, out)
+}
+
+func renderMarkdown(mdText string, anchors bool, out chan string) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Println("Parsing Markdown failed: ", err)
@@ -295,6 +774,9 @@ func processMarkdown(mdText string, out chan string) {
 	document := commonmark.ParseDocument(mdText, 0)
 	htmlString := document.RenderHtml(commonmark.CMARK_OPT_DEFAULT)
 	document.Free()
+	if anchors {
+		htmlString = wikit.AnchorHeadings(htmlString)
+	}
 	out <- p.Sanitize(htmlString)
 }
 
@@ -304,5 +786,12 @@ func getSanitizerPolicy() *bluemonday.Policy {
 		Matching(regexp.MustCompile(`[\p{L}\p{N}\s\-_',:\[\]!\./\\\(\)&]*`)).Globally()
 	p.AllowAttrs("data-id").
 		Matching(regexp.MustCompile(`[\p{L}\p{N}\s\-_',:\[\]!\./\\\(\)&]*`)).Globally()
+	p.AllowAttrs("data-wikilink").
+		Matching(regexp.MustCompile(`^(page|missing)$`)).OnElements("a")
+	//Only ids like the heading anchors, so content can't clobber the
+	//app's own element ids or the globals browsers make for them
+	p.AllowAttrs("id").
+		Matching(regexp.MustCompile(`^` + wikit.AnchorPrefix + `[\p{L}\p{N}_+\-]+$`)).
+		Globally()
 	return p
 }
@@ -33,8 +33,11 @@ package wiki_service_test
 import (
 	"encoding/json"
 	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service"
 	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"strings"
 	"testing"
+	"time"
 )
 
 func cleanup(wikiId string) {
@@ -67,11 +70,12 @@ func doPageTest(t *testing.T) {
 	page := wikit.Page{
 		Content: content,
 		Title:   "About",
+		Tags:    []string{"Project", " cafe", "project"},
 	}
 	//page = jsonifyPage(page)
 	//Create another page
 	sContent := wikit.PageContent{
-		Raw:       "Contact\n=\nContact Us\n--\n",
+		Raw:       "Contact\n=\nContact Us\n--\nSee [[About]] and [[Nowhere]]\n",
 		Formatted: "",
 	}
 	sPage := wikit.Page{
@@ -96,12 +100,77 @@ func doPageTest(t *testing.T) {
 	if sErr != nil {
 		t.Error(sErr)
 	}
+	//Wiki links
+	if len(sPage.Links) != 2 || sPage.Links[0].PageId != pageId ||
+		sPage.Links[1].PageId != "" {
+		t.Errorf("Wiki links not resolved: %v", sPage.Links)
+	}
+	if !strings.Contains(sPage.Content.Formatted, `data-wikilink="missing"`) {
+		t.Errorf("Missing page not marked: %v", sPage.Content.Formatted)
+	}
+	//Heading anchors and the outline
+	if !strings.Contains(page.Content.Formatted, `<h2 id="h-about-the-project">`) {
+		t.Errorf("Heading has no anchor: %v", page.Content.Formatted)
+	}
+	outline, err := pm.GetOutline(wikiId, pageId, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(outline) != 2 || outline[1].Level != 2 ||
+		outline[1].Anchor != "h-about-the-project" {
+		t.Errorf("Unexpected outline: %v", outline)
+	}
+	//Backlinks
+	backlinks, err := pm.Backlinks(wikiId, pageId, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(backlinks) != 1 || backlinks[0].Id != sPageId {
+		t.Errorf("Backlinks should list the contact page: %v", backlinks)
+	}
+	//Link report
+	report, err := wm.LinkReport(wikiId, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(report.BrokenLinks) != 1 ||
+		report.BrokenLinks[0].Link.Slug != "nowhere" {
+		t.Errorf("Report should list the broken link: %v", report.BrokenLinks)
+	}
+	//Creating the missing page resolves the links to it
+	nPage := wikit.Page{
+		Content:       wikit.PageContent{Raw: "## 日本語\n\nSomewhere after all"},
+		Title:         "Nowhere",
+		PreviousSlugs: []string{"lost-page"},
+	}
+	nPageId := getUuid()
+	if _, err = pm.Save(wikiId, &nPage, nPageId, "", curUser); err != nil {
+		t.Error(err)
+	}
+	//Headings in other scripts keep their anchors
+	if len(nPage.Outline) != 1 || nPage.Outline[0].Anchor != "h-日本語" {
+		t.Errorf("CJK heading lost its anchor: %v", nPage.Outline)
+	}
+	if report, err = wm.LinkReport(wikiId, curUser); err != nil {
+		t.Error(err)
+	} else if len(report.BrokenLinks) != 0 {
+		t.Errorf("Link to the new page isn't broken: %v", report.BrokenLinks)
+	}
+	resolved := false
+	for i := 0; i < 20 && !resolved; i++ {
+		time.Sleep(100 * time.Millisecond)
+		backlinks, err = pm.Backlinks(wikiId, nPageId, curUser)
+		resolved = err == nil && len(backlinks) == 1
+	}
+	if !resolved {
+		t.Errorf("Link to the new page should resolve: %v, %v", backlinks, err)
+	}
 	//Read Page
 	rPage := wikit.Page{}
-	nWikiId, rev, err := pm.ReadBySlug(wikiRecord.Slug, pageSlug, &rPage, curUser)
+	nWikiId, rev, redirect, err := pm.ReadBySlug(wikiRecord.Slug, pageSlug, &rPage, curUser)
 	if nWikiId == "" {
 		t.Error("wikiId is empty")
 	}
+	if redirect != nil {
+		t.Errorf("Current slugs shouldn't redirect: %v", *redirect)
+	}
 	if rev == "" {
 		t.Error("rev is empty!")
 	}
@@ -110,12 +179,33 @@ func doPageTest(t *testing.T) {
 	}
 
 	content = rPage.Content
-	if content.Formatted != "<h1>About</h1>\n<h2>About the project</h2>\n\n" {
+	if content.Formatted != "<h1 id=\"h-about\">About</h1>\n<h2 id=\"h-about-the-project\">About the project</h2>\n\n" {
 		t.Error("content.Formatted is wrong!")
 	}
 	if rPage.LastEditor != "John.Smith" {
 		t.Error("rPage is not John.Smith!")
 	}
+	//Rename a page, then find it by its old slug
+	oldSlug := sPage.Slug
+	sPage = jsonifyPage(sPage)
+	sPage.Title = "Get In Touch"
+	if _, err = pm.Save(wikiId, &sPage, sPageId, sRev, curUser); err != nil {
+		t.Error(err)
+	}
+	movedPage := wikit.Page{}
+	_, _, redirect, err = pm.ReadBySlug(wikiRecord.Slug, oldSlug, &movedPage, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if movedPage.Id != sPageId {
+		t.Errorf("Old slug should find the renamed page, found %v", movedPage.Id)
+	} else if redirect == nil || redirect.PageSlug != "get-in-touch" {
+		t.Errorf("Expected a redirect to the new slug: %v", redirect)
+	}
+	//New pages can't claim previous slugs
+	if _, _, _, err = pm.ReadBySlug(wikiRecord.Slug, "lost-page",
+		&wikit.Page{}, curUser); err == nil {
+		t.Error("A new page shouldn't keep the previous slugs it was saved with")
+	}
 	//Update Page
 	rPage = wikit.Page{}
 	rev, _ = pm.Read(wikiId, pageId, &rPage, curUser)
@@ -140,12 +230,179 @@ func doPageTest(t *testing.T) {
 	if len(hist.Rows) != 2 {
 		t.Errorf("Insufficient history length, should be 2 was %v", len(hist.Rows))
 	}
+	//Tags
+	tm := wiki_service.TagManager{}
+	tagged, err := tm.Pages(wikiId, []string{"cafe", "project"}, true, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(tagged) != 1 || tagged[0].Id != pageId {
+		t.Errorf("Tagged page not found: %v", tagged)
+	}
+	tagCounts, err := tm.Index(wikiId, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(tagCounts) != 2 {
+		t.Errorf("Should have two tags: %v", tagCounts)
+	}
+	//Tags survive in the history copy
+	oldPage := wikit.Page{}
+	if len(hist.Rows) < 2 {
+		t.Error("No history copy to check")
+	} else if _, err = pm.Read(wikiId, hist.Rows[1].Value.DocumentId,
+		&oldPage, curUser); err != nil {
+		t.Error(err)
+	} else if len(oldPage.Tags) != 2 {
+		t.Errorf("History copy lost its tags: %v", oldPage.Tags)
+	}
 	for _, hvr := range hist.Rows {
 		t.Logf("history item: %v", hvr)
 		if hvr.Value.Editor != "John.Smith" {
 			t.Error("Editor is wrong!")
 		}
 	}
+	//Revert to the original revision
+	origId := ""
+	for _, hvr := range hist.Rows {
+		if hvr.Value.DocumentId != pageId {
+			origId = hvr.Value.DocumentId
+		}
+	}
+	rPage = wikit.Page{}
+	rev, err = pm.Revert(wikiId, &rPage, pageId, rev, origId, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	if rPage.RevertedFrom != origId {
+		t.Errorf("RevertedFrom should be %v, was %v", origId, rPage.RevertedFrom)
+	}
+	if rPage.Content.Raw != page.Content.Raw {
+		t.Errorf("Content not reverted: %v", rPage.Content.Raw)
+	}
+	hist, err = pm.GetHistory(wikiId, pageId, 1, 0, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(hist.Rows) != 3 {
+		t.Errorf("History length should be 3 was %v", len(hist.Rows))
+	}
+	//Drafts
+	draft := wikit.Draft{
+		Title:   "About",
+		Content: wikit.PageContent{Raw: "Draft one"},
+	}
+	if _, err = pm.SaveDraft(wikiId, pageId, &draft, curUser); err != nil {
+		t.Error(err)
+	}
+	draft.Content.Raw = "Draft two"
+	if _, err = pm.SaveDraft(wikiId, pageId, &draft, curUser); err != nil {
+		t.Error(err)
+	}
+	readDraft := wikit.Draft{}
+	if _, err = pm.ReadDraft(wikiId, pageId, &readDraft, curUser); err != nil {
+		t.Error(err)
+	} else if readDraft.Content.Raw != "Draft two" {
+		t.Errorf("Draft content is wrong: %v", readDraft.Content.Raw)
+	}
+	//Another user can't read the draft, not even as a page
+	otherUser := &CurrentUserInfo{
+		Auth: curUser.Auth,
+		User: &User{UserName: "Jane.Doe", Roles: curUser.User.Roles},
+	}
+	if _, err = pm.ReadDraft(wikiId, pageId, &wikit.Draft{}, otherUser); err == nil {
+		t.Error("Another user shouldn't have a draft of the page")
+	}
+	if _, err = pm.Read(wikiId, wikit.DraftId(pageId, "John.Smith"),
+		&wikit.Page{}, otherUser); err == nil {
+		t.Error("A draft shouldn't be readable as a page")
+	}
+	rPage = wikit.Page{}
+	rev, err = pm.PublishDraft(wikiId, pageId, rev, &rPage, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	hist, err = pm.GetHistory(wikiId, pageId, 1, 0, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(hist.Rows) != 4 {
+		t.Errorf("History length should be 4 was %v", len(hist.Rows))
+	}
+	if _, err = pm.ReadDraft(wikiId, pageId, &readDraft, curUser); err == nil {
+		t.Error("Draft should be discarded after publishing")
+	}
+	//A draft conflicting with changes saved since it began isn't published
+	draft = wikit.Draft{
+		BaseRev: rev,
+		Title:   "About",
+		Content: wikit.PageContent{Raw: "Draft three"},
+	}
+	if _, err = pm.SaveDraft(wikiId, pageId, &draft, curUser); err != nil {
+		t.Error(err)
+	}
+	rPage.Content = wikit.PageContent{Raw: "Saved meanwhile"}
+	if rev, err = pm.Save(wikiId, &rPage, pageId, rev, curUser); err != nil {
+		t.Error(err)
+	}
+	_, err = pm.PublishDraft(wikiId, pageId, rev, &wikit.Page{}, curUser)
+	if _, ok := err.(*wiki_service.MergeConflictError); !ok {
+		t.Errorf("Publishing a conflicting draft should fail, got: %v", err)
+	}
+	if _, err = pm.DiscardDraft(wikiId, pageId, curUser); err != nil {
+		t.Error(err)
+	}
+	//Concurrent edits are merged
+	rPage.Content = wikit.PageContent{Raw: "one\ntwo\nthree\n"}
+	if rev, err = pm.Save(wikiId, &rPage, pageId, rev, curUser); err != nil {
+		t.Error(err)
+	}
+	baseRev := rev
+	theirPage := jsonifyPage(rPage)
+	theirPage.Content = wikit.PageContent{Raw: "one changed\ntwo\nthree\n"}
+	if rev, err = pm.Save(wikiId, &theirPage, pageId, baseRev, curUser); err != nil {
+		t.Error(err)
+	}
+	myPage := jsonifyPage(rPage)
+	myPage.Content = wikit.PageContent{Raw: "one\ntwo\nthree changed\n"}
+	if rev, err = pm.Save(wikiId, &myPage, pageId, baseRev, curUser); err != nil {
+		t.Error(err)
+	} else if myPage.Content.Raw != "one changed\ntwo\nthree changed\n" {
+		t.Errorf("Edits not merged: %q", myPage.Content.Raw)
+	}
+	//Conflicting edits are not
+	myPage = jsonifyPage(rPage)
+	myPage.Content = wikit.PageContent{Raw: "one mine\ntwo\nthree\n"}
+	_, err = pm.Save(wikiId, &myPage, pageId, baseRev, curUser)
+	if _, ok := err.(*wiki_service.MergeConflictError); !ok {
+		t.Errorf("Expected a merge conflict, got %v", err)
+	}
+	//Section edits only conflict within their section
+	rPage = wikit.Page{}
+	if rev, err = pm.Read(wikiId, pageId, &rPage, curUser); err != nil {
+		t.Error(err)
+	}
+	rPage.Content = wikit.PageContent{Raw: "# Menu\n\nCoffee\n\n# Hours\n\nNine to five\n"}
+	if rev, err = pm.Save(wikiId, &rPage, pageId, rev, curUser); err != nil {
+		t.Error(err)
+	}
+	sectionRev, section, err := pm.ReadSection(wikiId, pageId, "hours", curUser)
+	if err != nil {
+		t.Error(err)
+	} else if section.Content != "# Hours\n\nNine to five\n" {
+		t.Errorf("Wrong section content: %q", section.Content)
+	}
+	theirPage = jsonifyPage(rPage)
+	theirPage.Content = wikit.PageContent{Raw: "# Menu\n\nCoffee and tea\n\n# Hours\n\nNine to five\n"}
+	if _, err = pm.Save(wikiId, &theirPage, pageId, sectionRev, curUser); err != nil {
+		t.Error(err)
+	}
+	sectionPage := wikit.Page{}
+	_, err = pm.SaveSection(wikiId, pageId, sectionRev, "hours",
+		"# Hours\n\nEight to six\n", &sectionPage, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if sectionPage.Content.Raw != "# Menu\n\nCoffee and tea\n\n# Hours\n\nEight to six\n" {
+		t.Errorf("Section not spliced in: %q", sectionPage.Content.Raw)
+	}
 	//Page index
 	index, err := pm.Index(wikiId, curUser)
 	if err != nil {
@@ -180,7 +437,7 @@ func doPageTest(t *testing.T) {
 	//Comments
 	firstComment := wikit.Comment{
 		Content: wikit.PageContent{
-			Raw: "This is a comment",
+			Raw: "This is a comment for @John.Smith and @nobody.here",
 		},
 	}
 	secondComment := wikit.Comment{
@@ -192,6 +449,7 @@ func doPageTest(t *testing.T) {
 		Content: wikit.PageContent{
 			Raw: "This is a reply",
 		},
+		ParentComment: commentId,
 	}
 	_, err1 := pm.SaveComment(wikiId, pageId, &firstComment,
 		commentId, "", curUser)
@@ -202,6 +460,14 @@ func doPageTest(t *testing.T) {
 	if err1 != nil {
 		t.Error(err1)
 	}
+	//Only registered users' mentions are linked
+	if len(firstComment.Mentions) != 1 || firstComment.Mentions[0] != "John.Smith" {
+		t.Errorf("Wrong mentions: %v", firstComment.Mentions)
+	} else if !strings.Contains(firstComment.Content.Formatted,
+		`<a href="/app/users/John.Smith" data-mention="John.Smith">@John.Smith</a>`) ||
+		strings.Contains(firstComment.Content.Formatted, `data-mention="nobody.here"`) {
+		t.Errorf("Mentions not linked: %v", firstComment.Content.Formatted)
+	}
 	if err2 != nil {
 		t.Error(err2)
 	}
@@ -217,6 +483,15 @@ func doPageTest(t *testing.T) {
 	if numComments != 3 {
 		t.Errorf("Wrong number of comments, should be 3 was %v", numComments)
 	}
+	threads, err := pm.GetCommentThreads(wikiId, pageId, 1, 0, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if threads.TotalRows != 2 || len(threads.Threads) != 2 {
+		t.Errorf("Should be 2 threads: %v", threads)
+	} else if threads.Threads[0].ReplyCount != 1 ||
+		threads.Threads[0].Replies[0].Id != rCommentId {
+		t.Errorf("First thread should have the reply: %v", threads.Threads[0])
+	}
 	//Read comment
 	//Read the comment to get the revision
 	readComment := wikit.Comment{}
@@ -241,6 +516,101 @@ func doPageTest(t *testing.T) {
 	if dRev == "" {
 		t.Error("dRev is empty!")
 	}
+	//A comment with replies leaves a tombstone
+	if _, err = pm.DeleteComment(wikiId, commentId, curUser); err != nil {
+		t.Error(err)
+	}
+	readComment = wikit.Comment{}
+	if _, err = pm.ReadComment(wikiId, commentId, &readComment, curUser); err != nil {
+		t.Error(err)
+	} else if !readComment.Deleted || readComment.Content.Raw != "" {
+		t.Errorf("Comment should be a tombstone: %v", readComment)
+	}
+	//Which goes with its last reply
+	if _, err = pm.DeleteComment(wikiId, rCommentId, curUser); err != nil {
+		t.Error(err)
+	}
+	if _, err = pm.ReadComment(wikiId, commentId, &readComment, curUser); err == nil {
+		t.Error("Tombstone should be removed with its last reply")
+	}
+	//Watch the page's subtree
+	wam := new(wiki_service.WatchManager)
+	if _, err = wam.Watch(wikiId, pageId, true, curUser); err != nil {
+		t.Error(err)
+	}
+	watch, err := wam.Read(wikiId, pageId, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if !watch.Subtree || watch.User != curUser.User.UserName {
+		t.Errorf("Unexpected watch %v", watch)
+	}
+	watches, err := wam.Index(wikiId, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(watches) != 1 {
+		t.Errorf("Expected 1 watch, got %v", len(watches))
+	}
+	if err = wam.Unwatch(wikiId, pageId, curUser); err != nil {
+		t.Error(err)
+	}
+	//Restrict the page and its subtree
+	rm := new(wiki_service.RestrictionManager)
+	rPage = wikit.Page{}
+	rev, err = pm.Read(wikiId, pageId, &rPage, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	restriction := wikit.Restriction{Users: []string{"John.Smith"}, Subtree: true}
+	_, sr, err := rm.Set(wikiId, pageId, rev, &restriction, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(sr.Updated) != 1 || sr.Updated[0] != sPageId {
+		t.Errorf("Child page should inherit the restriction: %v", sr)
+	}
+	rPage = wikit.Page{}
+	if _, err = pm.Read(wikiId, sPageId, &rPage, curUser); err != nil {
+		t.Error(err)
+	} else if rPage.Restriction == nil || rPage.Restriction.Source != pageId {
+		t.Errorf("Child page has restriction %v", rPage.Restriction)
+	}
+	//Outsiders can't see the page's history, comments or tags
+	outsider := &CurrentUserInfo{
+		Auth: curUser.Auth,
+		User: &User{UserName: "Jane.Doe", Roles: []string{}},
+	}
+	if len(hist.Rows) > 1 {
+		if _, err = pm.Read(wikiId, hist.Rows[1].Value.DocumentId,
+			&wikit.Page{}, outsider); err == nil {
+			t.Error("History of a restricted page shouldn't be readable")
+		}
+	}
+	hiddenComment := wikit.Comment{
+		Content: wikit.PageContent{Raw: "This is a hidden comment"},
+	}
+	hiddenCommentId := getUuid()
+	if _, err = pm.SaveComment(wikiId, pageId, &hiddenComment,
+		hiddenCommentId, "", curUser); err != nil {
+		t.Error(err)
+	}
+	if _, err = pm.ReadComment(wikiId, hiddenCommentId,
+		&wikit.Comment{}, outsider); err == nil {
+		t.Error("Comment on a restricted page shouldn't be readable")
+	}
+	if tagCounts, err = tm.Index(wikiId, outsider); err != nil {
+		t.Error(err)
+	} else if len(tagCounts) != 0 {
+		t.Errorf("Tags of restricted pages shouldn't be counted: %v", tagCounts)
+	}
+	//The parent can only be changed by moving the page
+	rPage = wikit.Page{}
+	if sRev, err = pm.Read(wikiId, sPageId, &rPage, curUser); err != nil {
+		t.Error(err)
+	}
+	rPage.Parent = ""
+	rPage.Lineage = []string{sPageId}
+	if _, err = pm.Save(wikiId, &rPage, sPageId, sRev, curUser); err == nil {
+		t.Error("Saving a page with a new parent should fail")
+	}
 	//Delete Page
 	rPage = wikit.Page{}
 	rev, err = pm.Read(wikiId, pageId, &rPage, curUser)
@@ -248,14 +618,68 @@ func doPageTest(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	dRev, err = pm.Delete(wikiId, pageId, rev, curUser)
+	//A stale revision leaves the whole subtree alone
+	if _, _, err = pm.Delete(wikiId, pageId, "1-stale", wikit.DeleteRecursive,
+		false, curUser); err == nil {
+		t.Error("Deleting a stale revision should fail")
+	}
+	if _, err = pm.Read(wikiId, sPageId, &wikit.Page{}, curUser); err != nil {
+		t.Errorf("Child page should survive a failed delete: %v", err)
+	}
+	//Dry run of a recursive delete
+	_, plan, err := pm.Delete(wikiId, pageId, rev, wikit.DeleteRecursive,
+		true, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(plan.Deleted) != 2 || plan.Deleted[1].Id != sPageId {
+		t.Errorf("Dry run should list the child page: %v", plan.Deleted)
+	}
+	//Delete, promoting the child page
+	dRev, result, err := pm.Delete(wikiId, pageId, rev, "", false, curUser)
 	t.Logf("Del Rev: %v", dRev)
 	if err != nil {
 		t.Error(err)
 	}
-	if rev == "" {
+	if dRev == "" {
 		t.Error("dRev is empty!")
 	}
+	if result != nil && len(result.Moved) != 1 {
+		t.Errorf("Child page should be promoted: %v", result.Moved)
+	}
+	rPage = wikit.Page{}
+	if _, err = pm.Read(wikiId, sPageId, &rPage, curUser); err != nil {
+		t.Error(err)
+	} else if rPage.Parent != "" || len(rPage.Lineage) != 1 {
+		t.Errorf("Promoted page has parent %v, lineage %v",
+			rPage.Parent, rPage.Lineage)
+	} else if rPage.Restriction != nil {
+		t.Errorf("Promoted page kept its inherited restriction %v", rPage.Restriction)
+	}
+	//The creation and deletion show up in the recent changes
+	changes, _, err := new(wiki_service.ChangesManager).Wiki(wikiId, 1, 0, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	found := make(map[string]bool)
+	for _, change := range changes {
+		if change.PageId == pageId || change.PageId == sPageId {
+			found[change.Type] = true
+		}
+	}
+	if !found[wikit.ChangeCreated] || !found[wikit.ChangeDeleted] {
+		t.Errorf("Recent changes should list the creation and deletion: %v", changes)
+	}
+	//The user's activity across the wikis
+	cm := new(wiki_service.ChangesManager)
+	activity, err := cm.User("John.Smith", 1, 10, curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(activity) == 0 {
+		t.Error("John should have some activity")
+	}
+	if _, err = cm.User("Nobody.Here", 1, 10, curUser); err == nil {
+		t.Error("Activity of a missing user should fail")
+	}
 
 }
 
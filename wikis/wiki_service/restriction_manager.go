@@ -0,0 +1,86 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+)
+
+//Manages the restrictions limiting pages to named users and roles
+type RestrictionManager struct{}
+
+//Restricts a page, and if the restriction is for the subtree, its
+//descendants, to the named users and roles.  A nil restriction lifts
+//the page's own restriction.  Only wiki admins may restrict pages.
+func (rm *RestrictionManager) Set(wiki string, pageId string, pageRev string,
+	restriction *wikit.Restriction,
+	curUser *CurrentUserInfo) (string, *wikit.SubtreeResult, error) {
+	if !isWikiAdmin(wiki, curUser) {
+		return "", nil, NotAdminError()
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+	return theWiki.SetRestriction(pageId, pageRev, restriction)
+}
+
+//Whether the current user may see and edit pages with a restriction.
+//Wiki admins may see every page.
+func canAccess(wiki string, restriction *wikit.Restriction,
+	curUser *CurrentUserInfo) bool {
+	return restriction.Allows(curUser.User.UserName, curUser.User.Roles) ||
+		isWikiAdmin(wiki, curUser)
+}
+
+//Checks the current user may see a page.
+//Restricted pages are reported as not found, so they stay hidden.
+func checkRestriction(wiki string, page *wikit.Page,
+	curUser *CurrentUserInfo) error {
+	if !canAccess(wiki, page.Restriction, curUser) {
+		return NotFoundError()
+	}
+	return nil
+}
+
+//Removes the pages the current user may not see from a page index
+func filterRestricted(wiki string, index wikit.PageIndex,
+	curUser *CurrentUserInfo) wikit.PageIndex {
+	if index == nil {
+		return nil
+	}
+	visible := wikit.PageIndex{}
+	for _, entry := range index {
+		if canAccess(wiki, entry.Value.Restriction, curUser) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible
+}
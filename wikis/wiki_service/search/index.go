@@ -0,0 +1,489 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Full-text search for wiki pages
+package search
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//BM25 tuning parameters
+const k1 = 1.2
+const b = 0.75
+
+//Matches in a page title count for more than matches in the body
+const titleBoost = 3.0
+
+//Approximate length of a highlighted snippet, in characters
+const snippetLength = 200
+
+type Index struct {
+	sync.RWMutex
+	wikis map[string]*wikiIndex
+}
+
+//A page, as stored in the search index
+type Document struct {
+	Id        string
+	Slug      string
+	Title     string
+	Content   string
+	Editor    string
+	Timestamp time.Time
+	//For restricted pages, the users and roles that may find them
+	Restricted bool
+	Users      []string
+	Roles      []string
+}
+
+//A single search result
+type Hit struct {
+	Id        string    `json:"id"`
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Editor    string    `json:"editor"`
+	Timestamp time.Time `json:"timestamp"`
+	Score     float64   `json:"score"`
+	//Title and content excerpt, html escaped, with matches wrapped in <mark>
+	HighlightedTitle string `json:"highlightedTitle"`
+	Snippet          string `json:"snippet"`
+}
+
+type Results struct {
+	TotalRows int   `json:"totalRows"`
+	Offset    int   `json:"offset"`
+	Hits      []Hit `json:"hits"`
+}
+
+type wikiIndex struct {
+	docs     map[string]*indexedDoc
+	postings map[string]map[string]*posting
+	//Sums of field lengths, for computing the average
+	titleTokens   int
+	contentTokens int
+}
+
+type indexedDoc struct {
+	Document
+	titleLen   int
+	contentLen int
+	terms      []string
+}
+
+type posting struct {
+	titleFreq   int
+	contentFreq int
+}
+
+func NewIndex() *Index {
+	return &Index{wikis: make(map[string]*wikiIndex)}
+}
+
+func newWikiIndex() *wikiIndex {
+	return &wikiIndex{
+		docs:     make(map[string]*indexedDoc),
+		postings: make(map[string]map[string]*posting),
+	}
+}
+
+//Adds a page to the index, replacing any previous version of it
+func (idx *Index) Add(wikiId string, doc Document) {
+	titleTerms := Tokenize(doc.Title)
+	contentTerms := Tokenize(doc.Content)
+	idx.Lock()
+	defer idx.Unlock()
+	wi, ok := idx.wikis[wikiId]
+	if !ok {
+		wi = newWikiIndex()
+		idx.wikis[wikiId] = wi
+	}
+	wi.remove(doc.Id)
+	iDoc := &indexedDoc{
+		Document:   doc,
+		titleLen:   len(titleTerms),
+		contentLen: len(contentTerms),
+	}
+	counts := make(map[string]*posting)
+	for _, term := range titleTerms {
+		if p, ok := counts[term]; ok {
+			p.titleFreq++
+		} else {
+			counts[term] = &posting{titleFreq: 1}
+		}
+	}
+	for _, term := range contentTerms {
+		if p, ok := counts[term]; ok {
+			p.contentFreq++
+		} else {
+			counts[term] = &posting{contentFreq: 1}
+		}
+	}
+	for term, p := range counts {
+		plist, ok := wi.postings[term]
+		if !ok {
+			plist = make(map[string]*posting)
+			wi.postings[term] = plist
+		}
+		plist[doc.Id] = p
+		iDoc.terms = append(iDoc.terms, term)
+	}
+	wi.docs[doc.Id] = iDoc
+	wi.titleTokens += iDoc.titleLen
+	wi.contentTokens += iDoc.contentLen
+}
+
+//Removes a page from the index
+func (idx *Index) Remove(wikiId string, docId string) {
+	idx.Lock()
+	defer idx.Unlock()
+	if wi, ok := idx.wikis[wikiId]; ok {
+		wi.remove(docId)
+	}
+}
+
+//Drops every page belonging to a wiki
+func (idx *Index) RemoveWiki(wikiId string) {
+	idx.Lock()
+	defer idx.Unlock()
+	delete(idx.wikis, wikiId)
+}
+
+//Returns the number of pages indexed for a wiki
+func (idx *Index) Count(wikiId string) int {
+	idx.RLock()
+	defer idx.RUnlock()
+	if wi, ok := idx.wikis[wikiId]; ok {
+		return len(wi.docs)
+	}
+	return 0
+}
+
+func (wi *wikiIndex) remove(docId string) {
+	iDoc, ok := wi.docs[docId]
+	if !ok {
+		return
+	}
+	for _, term := range iDoc.terms {
+		if plist, ok := wi.postings[term]; ok {
+			delete(plist, docId)
+			if len(plist) == 0 {
+				delete(wi.postings, term)
+			}
+		}
+	}
+	wi.titleTokens -= iDoc.titleLen
+	wi.contentTokens -= iDoc.contentLen
+	delete(wi.docs, docId)
+}
+
+//Runs a query against a wiki's pages.
+//Results are ranked by relevance; pageNum starts at 1,
+//a numPerPage of 0 returns every hit.
+func (idx *Index) Search(wikiId string, query string,
+	pageNum int, numPerPage int) *Results {
+	return idx.SearchVisible(wikiId, query, pageNum, numPerPage, nil)
+}
+
+//Runs a query against the wiki's pages for which visible returns true.
+//A nil visible function searches every page.
+func (idx *Index) SearchVisible(wikiId string, query string,
+	pageNum int, numPerPage int, visible func(*Document) bool) *Results {
+	terms := uniqueTerms(Tokenize(query))
+	results := &Results{Hits: []Hit{}}
+	//visible may be slow, so don't hold the index lock while calling it
+	matches := idx.match(wikiId, terms)
+	docs := make(map[string]*Document, len(matches))
+	hits := make(hitList, 0, len(matches))
+	for i := range matches {
+		doc := &matches[i].Document
+		if visible != nil && !visible(doc) {
+			continue
+		}
+		docs[doc.Id] = doc
+		hits = append(hits, Hit{
+			Id:        doc.Id,
+			Slug:      doc.Slug,
+			Title:     doc.Title,
+			Editor:    doc.Editor,
+			Timestamp: doc.Timestamp,
+			Score:     matches[i].score,
+		})
+	}
+	sort.Sort(hits)
+	results.TotalRows = len(hits)
+	start := 0
+	end := len(hits)
+	if numPerPage > 0 {
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		start = numPerPage * (pageNum - 1)
+		if start > len(hits) {
+			start = len(hits)
+		}
+		if start+numPerPage < end {
+			end = start + numPerPage
+		}
+	}
+	results.Offset = start
+	//Only highlight the hits we're actually returning
+	for _, hit := range hits[start:end] {
+		doc := docs[hit.Id]
+		hit.HighlightedTitle = Highlight(doc.Title, terms, 0)
+		hit.Snippet = Highlight(stripMarkdown(doc.Content), terms, snippetLength)
+		results.Hits = append(results.Hits, hit)
+	}
+	return results
+}
+
+type match struct {
+	Document
+	score float64
+}
+
+//Scores the wiki's pages matching any of the terms.
+//The matched documents are copied out so the caller can use them unlocked.
+func (idx *Index) match(wikiId string, terms []string) []match {
+	idx.RLock()
+	defer idx.RUnlock()
+	wi, ok := idx.wikis[wikiId]
+	if !ok || len(terms) == 0 || len(wi.docs) == 0 {
+		return nil
+	}
+	numDocs := float64(len(wi.docs))
+	avgTitle := math.Max(float64(wi.titleTokens)/numDocs, 1)
+	avgContent := math.Max(float64(wi.contentTokens)/numDocs, 1)
+	scores := make(map[string]float64)
+	matched := make(map[string]int)
+	for _, term := range terms {
+		plist := wi.postings[term]
+		if len(plist) == 0 {
+			continue
+		}
+		df := float64(len(plist))
+		idf := math.Log(1 + (numDocs-df+0.5)/(df+0.5))
+		for docId, p := range plist {
+			iDoc := wi.docs[docId]
+			score := titleBoost * bm25(p.titleFreq, iDoc.titleLen, avgTitle)
+			score += bm25(p.contentFreq, iDoc.contentLen, avgContent)
+			scores[docId] += idf * score
+			matched[docId]++
+		}
+	}
+	matches := make([]match, 0, len(scores))
+	for docId, score := range scores {
+		//Pages matching every term should come first
+		coverage := float64(matched[docId]) / float64(len(terms))
+		matches = append(matches, match{
+			Document: wi.docs[docId].Document,
+			score:    score * coverage,
+		})
+	}
+	return matches
+}
+
+func bm25(tf int, fieldLen int, avgLen float64) float64 {
+	if tf == 0 {
+		return 0
+	}
+	freq := float64(tf)
+	norm := k1 * (1 - b + b*float64(fieldLen)/avgLen)
+	return freq * (k1 + 1) / (freq + norm)
+}
+
+type hitList []Hit
+
+func (h hitList) Len() int      { return len(h) }
+func (h hitList) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h hitList) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score > h[j].Score
+	}
+	return h[i].Title < h[j].Title
+}
+
+type token struct {
+	term  string
+	start int
+	end   int
+}
+
+//Splits text into lower case terms
+func Tokenize(text string) []string {
+	tokens := scanTokens(text)
+	terms := make([]string, len(tokens))
+	for i, tok := range tokens {
+		terms[i] = tok.term
+	}
+	return terms
+}
+
+//Splits text into tokens, keeping track of their byte offsets
+func scanTokens(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWordChar := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordChar && start < 0 {
+			start = i
+		} else if !isWordChar && start >= 0 {
+			tokens = append(tokens, token{
+				term:  strings.ToLower(text[start:i]),
+				start: start,
+				end:   i,
+			})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{
+			term:  strings.ToLower(text[start:]),
+			start: start,
+			end:   len(text),
+		})
+	}
+	return tokens
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+//Produces an html-escaped excerpt of text with each occurrence of the
+//given terms wrapped in <mark> tags.
+//If maxLength is 0, the entire text is returned
+func Highlight(text string, terms []string, maxLength int) string {
+	termSet := make(map[string]bool)
+	for _, term := range terms {
+		termSet[term] = true
+	}
+	tokens := scanTokens(text)
+	start := 0
+	end := len(text)
+	if maxLength > 0 && utf8.RuneCountInString(text) > maxLength {
+		start, end = bestWindow(text, tokens, termSet, maxLength)
+	}
+	var buf []string
+	if start > 0 {
+		buf = append(buf, "&hellip;")
+	}
+	pos := start
+	for _, tok := range tokens {
+		if tok.start < start || tok.end > end {
+			continue
+		}
+		if termSet[tok.term] {
+			buf = append(buf, html.EscapeString(text[pos:tok.start]))
+			buf = append(buf, "<mark>"+html.EscapeString(text[tok.start:tok.end])+"</mark>")
+			pos = tok.end
+		}
+	}
+	buf = append(buf, html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		buf = append(buf, "&hellip;")
+	}
+	return strings.TrimSpace(strings.Join(buf, ""))
+}
+
+//Finds the maxLength window of text containing the most distinct matches.
+//Returns the byte offsets of the window, snapped to token boundaries
+func bestWindow(text string, tokens []token, termSet map[string]bool,
+	maxLength int) (int, int) {
+	bestStart := 0
+	bestCount := 0
+	for i, tok := range tokens {
+		if !termSet[tok.term] {
+			continue
+		}
+		found := make(map[string]bool)
+		for _, next := range tokens[i:] {
+			if utf8.RuneCountInString(text[tok.start:next.end]) > maxLength {
+				break
+			}
+			if termSet[next.term] {
+				found[next.term] = true
+			}
+		}
+		if len(found) > bestCount {
+			bestCount = len(found)
+			bestStart = i
+		}
+	}
+	//Back up a few words so the match isn't the first thing in the snippet
+	first := bestStart
+	for first > 0 && bestStart-first < 3 {
+		first--
+	}
+	start := 0
+	if first > 0 {
+		start = tokens[first].start
+	}
+	end := start
+	for _, tok := range tokens {
+		if tok.start < start {
+			continue
+		}
+		if utf8.RuneCountInString(text[start:tok.end]) > maxLength {
+			break
+		}
+		end = tok.end
+	}
+	return start, end
+}
+
+var mdImage = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+var mdLink = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+var mdMarkup = regexp.MustCompile("(?m)^\\s*(#+|>+|[-*+]\\s|\\d+\\.\\s)|[*_`~]+")
+var whitespace = regexp.MustCompile(`\s+`)
+
+//Strips the more common markdown syntax so it doesn't clutter up snippets
+func stripMarkdown(text string) string {
+	text = mdImage.ReplaceAllString(text, "$1")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdMarkup.ReplaceAllString(text, "")
+	return whitespace.ReplaceAllString(text, " ")
+}
@@ -0,0 +1,190 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package search_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/search"
+	"strings"
+	"testing"
+)
+
+func loadIndex() *Index {
+	idx := NewIndex()
+	idx.Add("wiki1", Document{
+		Id:      "p1",
+		Slug:    "coffee-machine",
+		Title:   "Coffee Machine",
+		Content: "How to descale the coffee machine in the break room.",
+	})
+	idx.Add("wiki1", Document{
+		Id:      "p2",
+		Slug:    "break-room",
+		Title:   "Break Room",
+		Content: "The break room has a fridge, a sink and a coffee machine.",
+	})
+	idx.Add("wiki1", Document{
+		Id:      "p3",
+		Slug:    "parking",
+		Title:   "Parking",
+		Content: "Visitor parking is behind the building.",
+	})
+	idx.Add("wiki2", Document{
+		Id:      "p4",
+		Slug:    "coffee",
+		Title:   "Coffee",
+		Content: "Coffee beans are ordered on Mondays.",
+	})
+	return idx
+}
+
+func TestTokenize(t *testing.T) {
+	terms := Tokenize("Hello, World! It's 2016-ish")
+	expected := []string{"hello", "world", "it", "s", "2016", "ish"}
+	if len(terms) != len(expected) {
+		t.Fatalf("Expected %v terms, got %v", len(expected), terms)
+	}
+	for i, term := range expected {
+		if terms[i] != term {
+			t.Errorf("Term %v should be %v, was %v", i, term, terms[i])
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := loadIndex()
+	results := idx.Search("wiki1", "coffee", 1, 0)
+	if results.TotalRows != 2 {
+		t.Fatalf("Should have 2 results, had %v", results.TotalRows)
+	}
+	//Title matches rank first
+	if results.Hits[0].Id != "p1" {
+		t.Errorf("First hit should be p1, was %v", results.Hits[0].Id)
+	}
+	if results.Hits[0].HighlightedTitle != "<mark>Coffee</mark> Machine" {
+		t.Errorf("Bad title highlight: %v", results.Hits[0].HighlightedTitle)
+	}
+	if !strings.Contains(results.Hits[1].Snippet, "<mark>coffee</mark>") {
+		t.Errorf("Bad snippet: %v", results.Hits[1].Snippet)
+	}
+	//Other wikis' pages don't leak into results
+	for _, hit := range results.Hits {
+		if hit.Id == "p4" {
+			t.Error("Result from another wiki!")
+		}
+	}
+	//Pages matching every term rank above partial matches
+	results = idx.Search("wiki1", "parking coffee", 1, 0)
+	if results.TotalRows != 3 {
+		t.Errorf("Should have 3 results, had %v", results.TotalRows)
+	}
+	results = idx.Search("wiki1", "sink coffee", 1, 0)
+	if results.Hits[0].Id != "p2" {
+		t.Errorf("First hit should be p2, was %v", results.Hits[0].Id)
+	}
+	//Pagination
+	results = idx.Search("wiki1", "coffee", 2, 1)
+	if len(results.Hits) != 1 || results.Offset != 1 || results.TotalRows != 2 {
+		t.Errorf("Bad pagination: %v", results)
+	}
+	results = idx.Search("wiki1", "coffee", 3, 1)
+	if len(results.Hits) != 0 {
+		t.Errorf("Page 3 should be empty, was %v", results.Hits)
+	}
+}
+
+func TestSearchVisible(t *testing.T) {
+	idx := loadIndex()
+	idx.Add("wiki1", Document{
+		Id:         "p5",
+		Slug:       "coffee-budget",
+		Title:      "Coffee Budget",
+		Content:    "What we spend on coffee.",
+		Restricted: true,
+		Users:      []string{"finance"},
+	})
+	if results := idx.Search("wiki1", "coffee", 1, 0); results.TotalRows != 3 {
+		t.Errorf("Should have 3 results, had %v", results.TotalRows)
+	}
+	public := func(doc *Document) bool { return !doc.Restricted }
+	results := idx.SearchVisible("wiki1", "coffee", 1, 0, public)
+	if results.TotalRows != 2 {
+		t.Errorf("Should have 2 results, had %v", results.TotalRows)
+	}
+	for _, hit := range results.Hits {
+		if hit.Id == "p5" {
+			t.Error("Hidden page in results!")
+		}
+	}
+}
+
+func TestUpdateAndRemove(t *testing.T) {
+	idx := loadIndex()
+	idx.Add("wiki1", Document{
+		Id:      "p3",
+		Slug:    "parking",
+		Title:   "Parking",
+		Content: "Visitors may no longer park here. Buy a coffee instead.",
+	})
+	if results := idx.Search("wiki1", "building", 1, 0); results.TotalRows != 0 {
+		t.Error("Stale content still indexed")
+	}
+	if results := idx.Search("wiki1", "coffee", 1, 0); results.TotalRows != 3 {
+		t.Errorf("Should have 3 results, had %v", results.TotalRows)
+	}
+	idx.Remove("wiki1", "p1")
+	if results := idx.Search("wiki1", "descale", 1, 0); results.TotalRows != 0 {
+		t.Error("Removed page still indexed")
+	}
+	if idx.Count("wiki1") != 2 {
+		t.Errorf("Should have 2 pages, had %v", idx.Count("wiki1"))
+	}
+	idx.RemoveWiki("wiki2")
+	if results := idx.Search("wiki2", "coffee", 1, 0); results.TotalRows != 0 {
+		t.Error("Removed wiki still indexed")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	text := "<b>Fish</b> & chips"
+	hl := Highlight(text, []string{"chips"}, 0)
+	if hl != "&lt;b&gt;Fish&lt;/b&gt; &amp; <mark>chips</mark>" {
+		t.Errorf("Bad highlight: %v", hl)
+	}
+	long := strings.Repeat("lorem ipsum ", 50) + "needle " +
+		strings.Repeat("dolor sit ", 50)
+	hl = Highlight(long, []string{"needle"}, 60)
+	if !strings.Contains(hl, "<mark>needle</mark>") {
+		t.Errorf("Snippet is missing the match: %v", hl)
+	}
+	if !strings.HasPrefix(hl, "&hellip;") || !strings.HasSuffix(hl, "&hellip;") {
+		t.Errorf("Snippet should be elided: %v", hl)
+	}
+}
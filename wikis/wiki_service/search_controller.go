@@ -0,0 +1,133 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"github.com/emicklei/go-restful"
+	. "github.com/rhinoman/wikifeat/common/services"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/search"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type SearchController struct{}
+
+type SearchResponse struct {
+	Links     HatLinks         `json:"_links"`
+	Query     string           `json:"query"`
+	TotalRows int              `json:"totalRows"`
+	Offset    int              `json:"offset"`
+	Results   SearchResultList `json:"_embedded"`
+}
+
+type SearchResultList struct {
+	List []SearchResultItem `json:"ea:search_result"`
+}
+
+type SearchResultItem struct {
+	Links HatLinks   `json:"_links"`
+	Hit   search.Hit `json:"result"`
+}
+
+var searchUri = "/{wiki-id}/search"
+
+//Define routes
+func (sc SearchController) AddRoutes(ws *restful.WebService) {
+
+	ws.Route(ws.GET(searchUri).To(sc.search).
+		Doc("Search the pages in this wiki").
+		Operation("search").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.QueryParameter("q", "Search terms").DataType("string")).
+		Param(ws.QueryParameter("pageNum", "Page number for pagination").DataType("integer")).
+		Param(ws.QueryParameter("numPerPage", "Number of records to return").DataType("integer")).
+		Writes(SearchResponse{}))
+}
+
+func (sc SearchController) genSearchUri(wikiId string) string {
+	theUri := ApiPrefix() + "/wikis" + searchUri
+	return strings.Replace(theUri, "{wiki-id}", wikiId, 1)
+}
+
+//Search a wiki
+func (sc SearchController) search(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	query := strings.TrimSpace(request.QueryParameter("q"))
+	if wikiId == "" || query == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	numPerPage, err := strconv.Atoi(request.QueryParameter("numPerPage"))
+	if err != nil {
+		numPerPage = 25
+	}
+	pageNum, err := strconv.Atoi(request.QueryParameter("pageNum"))
+	if err != nil {
+		pageNum = 1
+	}
+	results, err := new(SearchManager).Search(wikiId, query,
+		pageNum, numPerPage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(sc.genSearchResponse(wikiId, query, results))
+}
+
+func (sc SearchController) genSearchResponse(wikiId string, query string,
+	results *search.Results) SearchResponse {
+	pc := PagesController{}
+	var list []SearchResultItem
+	for _, hit := range results.Hits {
+		list = append(list, SearchResultItem{
+			Links: HatLinks{
+				Self: &HatLink{Href: pc.genPageUri(wikiId, hit.Id), Method: "GET"},
+			},
+			Hit: hit,
+		})
+	}
+	selfUri := sc.genSearchUri(wikiId) + "?q=" + url.QueryEscape(query)
+	return SearchResponse{
+		Links:     HatLinks{Self: &HatLink{Href: selfUri, Method: "GET"}},
+		Query:     query,
+		TotalRows: results.TotalRows,
+		Offset:    results.Offset,
+		Results:   SearchResultList{List: list},
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+// Keeps the search index current by following the changes feed
+// of the main database and of every wiki database
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rhinoman/wikifeat/common/config"
+	. "github.com/rhinoman/wikifeat/common/database"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/search"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//How long CouchDB should hold a longpoll request open (milliseconds)
+const longpollTimeout = "30000"
+
+//How long to wait before retrying a failed changes request
+const retryInterval = 10 * time.Second
+
+//The search index shared by the wiki service
+var pageIndex = search.NewIndex()
+
+//Followers for each wiki database, keyed by wiki id
+var indexFollowers = struct {
+	sync.Mutex
+	m map[string]chan bool
+}{m: make(map[string]chan bool)}
+
+var feedClient = &http.Client{Timeout: 45 * time.Second}
+
+var errDbNotFound = errors.New("Database not found")
+
+type changesResponse struct {
+	Results []changeRow     `json:"results"`
+	LastSeq json.RawMessage `json:"last_seq"`
+}
+
+type changeRow struct {
+	Id      string          `json:"id"`
+	Deleted bool            `json:"deleted"`
+	Doc     json.RawMessage `json:"doc"`
+}
+
+type changedPage struct {
+	wikit.Page
+	LegacyOwningPage string `json:"owning_page"`
+}
+
+//Starts following the main database for wiki records.
+//Each wiki found gets its own changes follower.
+func StartSearchIndexer() {
+	log.Println("Starting search indexer")
+	go followMainDb()
+}
+
+func followMainDb() {
+	since := "0"
+	for {
+		changes, err := getChanges(MainDbName(), since)
+		if err != nil {
+			log.Printf("Search indexer: error reading main db changes: %v", err)
+			time.Sleep(retryInterval)
+			continue
+		}
+		for _, row := range changes.Results {
+			if row.Deleted {
+				stopFollowing(row.Id)
+				continue
+			}
+			var doc struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal(row.Doc, &doc); err != nil {
+				continue
+			}
+			if doc.Type == "wiki_record" {
+				startFollowing(row.Id)
+			}
+		}
+		since = seqString(changes.LastSeq, since)
+	}
+}
+
+func startFollowing(wikiId string) {
+	indexFollowers.Lock()
+	defer indexFollowers.Unlock()
+	if _, ok := indexFollowers.m[wikiId]; ok {
+		return
+	}
+	stop := make(chan bool, 1)
+	indexFollowers.m[wikiId] = stop
+	go followWiki(wikiId, stop)
+}
+
+func stopFollowing(wikiId string) {
+	indexFollowers.Lock()
+	defer indexFollowers.Unlock()
+	if stop, ok := indexFollowers.m[wikiId]; ok {
+		stop <- true
+		delete(indexFollowers.m, wikiId)
+	}
+	pageIndex.RemoveWiki(wikiId)
+}
+
+func followWiki(wikiId string, stop chan bool) {
+	log.Printf("Search indexer: following wiki %v", wikiId)
+	dbName := wikiDbString(wikiId)
+	since := "0"
+	backoff := time.Second
+	for {
+		select {
+		case <-stop:
+			log.Printf("Search indexer: no longer following wiki %v", wikiId)
+			return
+		default:
+		}
+		changes, err := getChanges(dbName, since)
+		if err == errDbNotFound {
+			//The wiki record is saved before its database is created.
+			//Keep trying until the main db reports the record deleted.
+			if stopped(stop, backoff) {
+				log.Printf("Search indexer: no longer following wiki %v", wikiId)
+				return
+			}
+			if backoff *= 2; backoff > retryInterval {
+				backoff = retryInterval
+			}
+			continue
+		} else if err != nil {
+			log.Printf("Search indexer: error reading changes for %v: %v",
+				dbName, err)
+			if stopped(stop, retryInterval) {
+				log.Printf("Search indexer: no longer following wiki %v", wikiId)
+				return
+			}
+			continue
+		}
+		backoff = time.Second
+		for _, row := range changes.Results {
+			indexChange(wikiId, row)
+		}
+		since = seqString(changes.LastSeq, since)
+	}
+}
+
+//Waits for a while, unless told to stop first.  Returns whether to stop.
+func stopped(stop chan bool, wait time.Duration) bool {
+	select {
+	case <-stop:
+		return true
+	case <-time.After(wait):
+		return false
+	}
+}
+
+//Updates the index for a single changed document
+func indexChange(wikiId string, row changeRow) {
+	if strings.HasPrefix(row.Id, "_design/") {
+		return
+	}
+	if row.Deleted {
+		pageIndex.Remove(wikiId, row.Id)
+		return
+	}
+	page := changedPage{}
+	if err := json.Unmarshal(row.Doc, &page); err != nil {
+		return
+	}
+	owningPage := page.OwningPage
+	if owningPage == "" {
+		owningPage = page.LegacyOwningPage
+	}
+	//Only current pages are searchable, not historical copies
+	if page.DocType != "page" || owningPage != row.Id {
+		return
+	}
+	doc := search.Document{
+		Id:        row.Id,
+		Slug:      page.Slug,
+		Title:     page.Title,
+		Content:   page.Content.Raw,
+		Editor:    page.LastEditor,
+		Timestamp: page.Timestamp,
+	}
+	if r := page.Restriction; r != nil {
+		doc.Restricted = true
+		doc.Users = r.Users
+		doc.Roles = r.Roles
+	}
+	pageIndex.Add(wikiId, doc)
+}
+
+//Fetches the next batch of changes from a database's changes feed
+func getChanges(dbName string, since string) (*changesResponse, error) {
+	params := url.Values{}
+	params.Add("feed", "longpoll")
+	params.Add("include_docs", "true")
+	params.Add("timeout", longpollTimeout)
+	params.Add("since", since)
+	reqUrl := couchUrl() + "/" + dbName + "/_changes?" + params.Encode()
+	request, err := http.NewRequest("GET", reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Accept", "application/json")
+	AdminAuth.AddAuthHeaders(request)
+	resp, err := feedClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errDbNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Changes request failed: " + resp.Status)
+	}
+	changes := changesResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+func couchUrl() string {
+	protocol := "http://"
+	if config.Database.UseSSL {
+		protocol = "https://"
+	}
+	return protocol + config.Database.DbAddr + ":" + config.Database.DbPort
+}
+
+//CouchDB 1.x uses integer sequences, 2.x uses opaque strings
+func seqString(seq json.RawMessage, prev string) string {
+	if len(seq) == 0 {
+		return prev
+	}
+	var str string
+	if err := json.Unmarshal(seq, &str); err == nil {
+		return str
+	}
+	return string(seq)
+}
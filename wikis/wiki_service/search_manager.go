@@ -0,0 +1,61 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/search"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+)
+
+type SearchManager struct{}
+
+//Searches the pages of a wiki.
+//Only returns results if the current user can read the wiki,
+//and leaves out the pages restricted from the current user
+func (sm *SearchManager) Search(wiki string, query string, pageNum int,
+	numPerPage int, curUser *CurrentUserInfo) (*search.Results, error) {
+	auth := curUser.Auth
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), auth)
+	//Let CouchDB decide if this user has read access
+	if err := theWiki.CheckReadAccess(); err != nil {
+		return nil, err
+	}
+	visible := func(doc *search.Document) bool {
+		if !doc.Restricted {
+			return true
+		}
+		restriction := &wikit.Restriction{Users: doc.Users, Roles: doc.Roles}
+		return canAccess(wiki, restriction, curUser)
+	}
+	return pageIndex.SearchVisible(wiki, query, pageNum, numPerPage, visible), nil
+}
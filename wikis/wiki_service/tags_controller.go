@@ -0,0 +1,130 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"github.com/emicklei/go-restful"
+	. "github.com/rhinoman/wikifeat/common/services"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"net/url"
+	"strings"
+)
+
+type TagsController struct{}
+
+type TagIndexResponse struct {
+	Links HatLinks         `json:"_links"`
+	Tags  []wikit.TagCount `json:"tags"`
+}
+
+var tagsUri = "/{wiki-id}/tags"
+
+//Define routes
+func (tc TagsController) AddRoutes(ws *restful.WebService) {
+
+	ws.Route(ws.GET(tagsUri).To(tc.index).
+		Doc("Lists the tags used in this wiki, with page counts").
+		Operation("index").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Writes(TagIndexResponse{}))
+
+	ws.Route(ws.GET(tagsUri + "/pages").To(tc.pages).
+		Doc("Lists the pages carrying the given tags").
+		Operation("pages").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.QueryParameter("tags", "Comma separated list of tags").DataType("string")).
+		Param(ws.QueryParameter("match", "'any' (default) or 'all' of the tags").DataType("string")).
+		Writes(PageIndexResponse{}))
+}
+
+func (tc TagsController) genTagsUri(wikiId string) string {
+	theUri := ApiPrefix() + "/wikis" + tagsUri
+	return strings.Replace(theUri, "{wiki-id}", wikiId, 1)
+}
+
+//List tags
+func (tc TagsController) index(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	tags, err := new(TagManager).Index(wikiId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(TagIndexResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: tc.genTagsUri(wikiId), Method: "GET"},
+		},
+		Tags: tags,
+	})
+}
+
+//List pages by tag
+func (tc TagsController) pages(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	tagParam := request.QueryParameter("tags")
+	match := request.QueryParameter("match")
+	if tagParam == "" || (match != "" && match != "any" && match != "all") {
+		WriteBadRequestError(response)
+		return
+	}
+	tags := strings.Split(tagParam, ",")
+	pIndex, err := new(TagManager).Pages(wikiId, tags, match == "all", curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	pc := PagesController{}
+	indexResponse := pc.getIndexResponse(wikiId, curUser, pIndex)
+	query := url.Values{}
+	query.Add("tags", tagParam)
+	if match != "" {
+		query.Add("match", match)
+	}
+	indexResponse.Links = HatLinks{
+		Self: &HatLink{Href: tc.genTagsUri(wikiId) + "/pages?" + query.Encode(),
+			Method: "GET"},
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(indexResponse)
+}
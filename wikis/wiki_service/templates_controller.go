@@ -0,0 +1,367 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"github.com/emicklei/go-restful"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	. "github.com/rhinoman/wikifeat/common/services"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"net/http"
+)
+
+type TemplatesController struct{}
+
+type TemplateResponse struct {
+	Links    HatLinks       `json:"_links"`
+	Template wikit.Template `json:"template"`
+}
+
+type TemplateIndexResponse struct {
+	Links             HatLinks          `json:"_links"`
+	TemplateIndexList TemplateIndexList `json:"_embedded"`
+}
+
+type TemplateIndexList struct {
+	List []TemplateIndexItem `json:"ea:template"`
+}
+
+type TemplateIndexItem struct {
+	Links HatLinks          `json:"_links"`
+	Entry TemplateListEntry `json:"entry"`
+}
+
+type NewPageFromTemplate struct {
+	Title  string `json:"title"`
+	Parent string `json:"parent"`
+}
+
+//Wiki templates
+var templateUri = "/{wiki-id}/templates"
+
+//Global templates
+var globalTemplateUri = "/templates"
+
+//Define routes
+func (tc TemplatesController) AddRoutes(ws *restful.WebService) {
+
+	ws.Route(ws.GET(globalTemplateUri).To(tc.index).
+		Doc("Get a list of global templates").
+		Operation("globalIndex").
+		Writes(TemplateIndexResponse{}))
+
+	ws.Route(ws.POST(globalTemplateUri).To(tc.create).
+		Doc("Create a global template").
+		Operation("globalCreate").
+		Reads(wikit.Template{}).
+		Writes(TemplateResponse{}))
+
+	ws.Route(ws.GET(globalTemplateUri + "/{template-id}").To(tc.read).
+		Doc("Read a global template").
+		Operation("globalRead").
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Writes(TemplateResponse{}))
+
+	ws.Route(ws.PUT(globalTemplateUri + "/{template-id}").To(tc.update).
+		Doc("Update a global template").
+		Operation("globalUpdate").
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Template revision").DataType("string")).
+		Reads(wikit.Template{}).
+		Writes(TemplateResponse{}))
+
+	ws.Route(ws.DELETE(globalTemplateUri + "/{template-id}").To(tc.del).
+		Doc("Delete a global template").
+		Operation("globalDel").
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Template revision").DataType("string")).
+		Writes(BooleanResponse{}))
+
+	ws.Route(ws.GET(templateUri).To(tc.index).
+		Doc("Get a list of templates available in this wiki, including global templates").
+		Operation("index").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Writes(TemplateIndexResponse{}))
+
+	ws.Route(ws.POST(templateUri).To(tc.create).
+		Doc("Create a template").
+		Operation("create").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Reads(wikit.Template{}).
+		Writes(TemplateResponse{}))
+
+	ws.Route(ws.GET(templateUri + "/{template-id}").To(tc.read).
+		Doc("Read a template").
+		Operation("read").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Writes(TemplateResponse{}))
+
+	ws.Route(ws.PUT(templateUri + "/{template-id}").To(tc.update).
+		Doc("Update a template").
+		Operation("update").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Template revision").DataType("string")).
+		Reads(wikit.Template{}).
+		Writes(TemplateResponse{}))
+
+	ws.Route(ws.DELETE(templateUri + "/{template-id}").To(tc.del).
+		Doc("Delete a template").
+		Operation("del").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "Template revision").DataType("string")).
+		Writes(BooleanResponse{}))
+
+	ws.Route(ws.POST(templateUri + "/{template-id}/pages").To(tc.createPage).
+		Doc("Create a new Page from a wiki or global template").
+		Operation("createPage").
+		Param(ws.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(ws.PathParameter("template-id", "Template identifier").DataType("string")).
+		Reads(NewPageFromTemplate{}).
+		Writes(PageResponse{}))
+}
+
+//Generates a template uri.  An empty wiki id is for global templates
+func (tc TemplatesController) genTemplateUri(wikiId string, templateId string) string {
+	theUri := ApiPrefix() + "/wikis"
+	if wikiId != "" {
+		theUri += "/" + wikiId
+	}
+	theUri += "/templates"
+	if templateId != "" {
+		theUri += "/" + templateId
+	}
+	return theUri
+}
+
+func (tc TemplatesController) templateDbName(wikiId string) string {
+	if wikiId == "" {
+		return MainDbName()
+	}
+	return "wiki_" + wikiId
+}
+
+//Get list of templates
+func (tc TemplatesController) index(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	entries, err := new(TemplateManager).Index(wikiId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	indexList := []TemplateIndexItem{}
+	for _, entry := range entries {
+		scope := wikiId
+		if entry.Global {
+			scope = ""
+		}
+		indexList = append(indexList, TemplateIndexItem{
+			Links: GenRecordLinks(curUser.User.Roles, tc.templateDbName(scope),
+				tc.genTemplateUri(scope, entry.Id)),
+			Entry: entry,
+		})
+	}
+	indexUri := tc.genTemplateUri(wikiId, "")
+	links := GenRecordLinks(curUser.User.Roles, tc.templateDbName(wikiId), indexUri)
+	if links.Update != nil {
+		links.Create = &HatLink{Href: indexUri, Method: "POST"}
+	}
+	links.Update = nil
+	links.Delete = nil
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(TemplateIndexResponse{
+		Links:             links,
+		TemplateIndexList: TemplateIndexList{List: indexList},
+	})
+}
+
+//Create a template
+func (tc TemplatesController) create(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	theTemplate := new(wikit.Template)
+	if err := request.ReadEntity(theTemplate); err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	templateId := GenUuid()
+	rev, err := new(TemplateManager).Save(wikiId, theTemplate,
+		templateId, "", curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	response.WriteHeader(http.StatusCreated)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(tc.genRecordResponse(curUser, wikiId,
+		templateId, theTemplate))
+}
+
+//Read a template
+func (tc TemplatesController) read(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	templateId := request.PathParameter("template-id")
+	theTemplate := new(wikit.Template)
+	rev, err := new(TemplateManager).Read(wikiId, templateId,
+		theTemplate, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(tc.genRecordResponse(curUser, wikiId,
+		templateId, theTemplate))
+}
+
+//Update a template
+func (tc TemplatesController) update(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	templateId := request.PathParameter("template-id")
+	rev := request.HeaderParameter("If-Match")
+	if templateId == "" || rev == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	theTemplate := new(wikit.Template)
+	if err := request.ReadEntity(theTemplate); err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	rev, err := new(TemplateManager).Save(wikiId, theTemplate,
+		templateId, rev, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(tc.genRecordResponse(curUser, wikiId,
+		templateId, theTemplate))
+}
+
+//Delete a template
+func (tc TemplatesController) del(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	templateId := request.PathParameter("template-id")
+	rev := request.HeaderParameter("If-Match")
+	if templateId == "" || rev == "" {
+		WriteBadRequestError(response)
+		return
+	}
+	rev, err := new(TemplateManager).Delete(wikiId, templateId, rev, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.AddHeader("ETag", rev)
+	response.WriteEntity(BooleanResponse{Success: true})
+}
+
+//Create a page from a template
+func (tc TemplatesController) createPage(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	templateId := request.PathParameter("template-id")
+	npt := new(NewPageFromTemplate)
+	if err := request.ReadEntity(npt); err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	thePage := new(wikit.Page)
+	pageId, rev, err := new(TemplateManager).CreatePage(wikiId, templateId,
+		npt.Title, npt.Parent, thePage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	response.AddHeader("ETag", rev)
+	response.WriteHeader(http.StatusCreated)
+	pr := PagesController{}.genRecordResponse(curUser, wikiId, pageId, thePage)
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(pr)
+}
+
+func (tc TemplatesController) genRecordResponse(curUser *CurrentUserInfo,
+	wikiId string, templateId string, template *wikit.Template) TemplateResponse {
+	template.Id = templateId
+	links := GenRecordLinks(curUser.User.Roles, tc.templateDbName(wikiId),
+		tc.genTemplateUri(wikiId, templateId))
+	if wikiId != "" {
+		links.Create = &HatLink{
+			Href:   tc.genTemplateUri(wikiId, templateId) + "/pages",
+			Method: "POST",
+		}
+	}
+	return TemplateResponse{
+		Links:    links,
+		Template: *template,
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"github.com/rhinoman/couchdb-go"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/common/util"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"time"
+)
+
+//Manages page templates.
+//Wiki templates live in the wiki's database; global templates,
+//available to every wiki, live in the main database.
+//An empty wiki id refers to the global templates.
+type TemplateManager struct{}
+
+type TemplateListEntry struct {
+	wikit.TemplateIndexEntry
+	Global bool `json:"global"`
+}
+
+func templateDb(wiki string, curUser *CurrentUserInfo) *wikit.Wiki {
+	if wiki == "" {
+		return wikit.SelectWiki(Connection, MainDbName(), curUser.Auth)
+	}
+	return wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+}
+
+//Only site admins may change the global templates
+func (tm *TemplateManager) checkWriteAccess(wiki string,
+	curUser *CurrentUserInfo) error {
+	userRoles := curUser.User.Roles
+	if wiki == "" && !util.HasRole(userRoles, AdminRole(MainDbName())) &&
+		!util.HasRole(userRoles, MasterRole()) {
+		return NotAdminError()
+	}
+	return nil
+}
+
+//Lists the templates available in a wiki, including the global ones
+//Pass an empty wiki id to list only the global templates
+func (tm *TemplateManager) Index(wiki string,
+	curUser *CurrentUserInfo) ([]TemplateListEntry, error) {
+	entries := []TemplateListEntry{}
+	if wiki != "" {
+		wikiTemplates, err := templateDb(wiki, curUser).GetTemplateIndex()
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range wikiTemplates {
+			entries = append(entries, TemplateListEntry{row.Value, false})
+		}
+	}
+	globalTemplates, err := templateDb("", curUser).GetTemplateIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range globalTemplates {
+		entries = append(entries, TemplateListEntry{row.Value, true})
+	}
+	return entries, nil
+}
+
+//Read a template
+func (tm *TemplateManager) Read(wiki string, id string,
+	template *wikit.Template, curUser *CurrentUserInfo) (string, error) {
+	return templateDb(wiki, curUser).ReadTemplate(id, template)
+}
+
+//Create or update a template
+func (tm *TemplateManager) Save(wiki string, template *wikit.Template,
+	id string, rev string, curUser *CurrentUserInfo) (string, error) {
+	if err := tm.checkWriteAccess(wiki, curUser); err != nil {
+		return "", err
+	}
+	return templateDb(wiki, curUser).SaveTemplate(template, id, rev,
+		curUser.User.UserName)
+}
+
+//Delete a template
+func (tm *TemplateManager) Delete(wiki string, id string, rev string,
+	curUser *CurrentUserInfo) (string, error) {
+	if err := tm.checkWriteAccess(wiki, curUser); err != nil {
+		return "", err
+	}
+	return templateDb(wiki, curUser).DeleteTemplate(id, rev)
+}
+
+//Creates a new page in a wiki from one of its templates or a global one.
+//Returns the new page's id and revision
+func (tm *TemplateManager) CreatePage(wiki string, templateId string,
+	title string, parent string, page *wikit.Page,
+	curUser *CurrentUserInfo) (string, string, error) {
+	template := wikit.Template{}
+	_, err := tm.Read(wiki, templateId, &template, curUser)
+	if cErr, ok := err.(*couchdb.Error); ok && cErr.StatusCode == 404 {
+		_, err = tm.Read("", templateId, &template, curUser)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	*page = *template.NewPage(title, curUser.User.UserName, time.Now().UTC())
+	page.Parent = parent
+	pageId := GenUuid()
+	rev, err := new(PageManager).Save(wiki, page, pageId, "", curUser)
+	return pageId, rev, err
+}
@@ -0,0 +1,252 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"errors"
+	"github.com/rhinoman/couchdb-go"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/common/registry"
+	"github.com/rhinoman/wikifeat/common/util"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+//Manages users' watches on pages, and the emails sent when
+//watched pages change
+type WatchManager struct{}
+
+//Longest comment excerpt included in a notification
+const commentExcerptLength = 200
+
+//Watches a page, or with subtree set, the page and its descendants.
+//Readers may watch pages too, so watches are stored with the
+//service's own credentials.
+func (wam *WatchManager) Watch(wiki string, pageId string, subtree bool,
+	curUser *CurrentUserInfo) (*wikit.Watch, error) {
+	if err := wam.checkWatcher(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), AdminAuth)
+	watch := wikit.Watch{Subtree: subtree}
+	if _, err := theWiki.SaveWatch(&watch, pageId, curUser.User.UserName); err != nil {
+		return nil, err
+	}
+	watch.Id = wikit.WatchId(pageId, curUser.User.UserName)
+	return &watch, nil
+}
+
+//Reads the current user's watch on a page
+func (wam *WatchManager) Read(wiki string, pageId string,
+	curUser *CurrentUserInfo) (*wikit.Watch, error) {
+	if err := wam.checkWatcher(wiki, pageId, curUser); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), AdminAuth)
+	watch := wikit.Watch{}
+	if _, err := theWiki.ReadWatch(pageId, curUser.User.UserName, &watch); err != nil {
+		return nil, err
+	}
+	return &watch, nil
+}
+
+//Stops watching a page
+func (wam *WatchManager) Unwatch(wiki string, pageId string,
+	curUser *CurrentUserInfo) error {
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), AdminAuth)
+	_, err := theWiki.DeleteWatch(pageId, curUser.User.UserName)
+	return err
+}
+
+//Lists the current user's watches in a wiki
+func (wam *WatchManager) Index(wiki string,
+	curUser *CurrentUserInfo) ([]wikit.Watch, error) {
+	//Let CouchDB decide if this user has read access
+	userWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+	if err := userWiki.CheckReadAccess(); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), AdminAuth)
+	return theWiki.GetUserWatches(curUser.User.UserName)
+}
+
+//Only registered users who can see the page may watch it
+func (wam *WatchManager) checkWatcher(wiki string, pageId string,
+	curUser *CurrentUserInfo) error {
+	if curUser.User.UserName == "guest" {
+		return &couchdb.Error{StatusCode: 403, Reason: "Guests can't watch pages"}
+	}
+	return new(PageManager).checkPageAccess(wiki, pageId, curUser)
+}
+
+//Emails the users watching a page about a change made to it by the
+//current user.  The action describes the change ("edited", "created",
+//"commented on") and the summary what was changed.
+func (wam *WatchManager) PageChanged(wiki string, pageId string,
+	action string, summary string, curUser *CurrentUserInfo) {
+	page := wikit.Page{}
+	if _, err := new(PageManager).Read(wiki, pageId, &page, curUser); err != nil {
+		log.Printf("Error reading changed page %v: %v", pageId, err)
+		return
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), AdminAuth)
+	watches, err := theWiki.GetWatchers(page.Lineage)
+	if err != nil {
+		log.Printf("Error reading watches of page %v: %v", pageId, err)
+		return
+	} else if len(watches) == 0 {
+		return
+	}
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).Read(wiki, &wr, curUser); err != nil {
+		log.Printf("Error reading wiki %v: %v", wiki, err)
+		return
+	}
+	editor := curUser.User.UserName
+	subject := "[" + wr.Name + "] " + page.Title + " was " + action + " by " + editor
+	data := map[string]string{
+		"editor":  editor,
+		"action":  action,
+		"wiki":    wr.Name,
+		"page":    page.Title,
+		"summary": summary,
+		"uri":     "/app/wikis/" + wr.Slug + "/pages/" + page.Slug,
+	}
+	//Nobody needs to hear about their own changes
+	notified := map[string]bool{editor: true}
+	for _, watch := range watches {
+		if notified[watch.User] {
+			continue
+		}
+		notified[watch.User] = true
+		watcher, err := readerOf(wiki, &page, watch.User)
+		if err != nil {
+			log.Printf("Not notifying %v of changes to %v: %v", watch.User, pageId, err)
+			continue
+		} else if watcher.Public.Contact.Email == "" {
+			continue
+		}
+		nr := NotificationRequest{
+			To:      watcher.Public.Contact.Email,
+			Subject: subject,
+			Data:    map[string]string{"user": watcher.Public.FirstName},
+		}
+		if nr.Data["user"] == "" {
+			nr.Data["user"] = watch.User
+		}
+		for key, value := range data {
+			nr.Data[key] = value
+		}
+		if err := sendNotification("page_changed", &nr); err != nil {
+			log.Printf("Error notifying %v of changes to %v: %v", watch.User, pageId, err)
+		}
+	}
+}
+
+//Reads a user's record, if the user may still read a page
+func readerOf(wiki string, page *wikit.Page, userName string) (*User, error) {
+	user := User{}
+	userDb := Connection.SelectDB(UserDbName, AdminAuth)
+	if _, err := userDb.Read(UserPrefix+userName, &user, nil); err != nil {
+		return nil, err
+	}
+	sec, err := Connection.SelectDB(wikiDbString(wiki), AdminAuth).GetSecurity()
+	if err != nil {
+		return nil, err
+	}
+	if !isMember(sec, &user) {
+		return nil, errors.New("No longer a reader of the wiki")
+	}
+	if !canAccess(wiki, page.Restriction, &CurrentUserInfo{User: &user}) {
+		return nil, errors.New("Page is restricted")
+	}
+	return &user, nil
+}
+
+//Whether a database's security document lets a user in
+func isMember(sec *couchdb.Security, user *User) bool {
+	for _, members := range []couchdb.Members{sec.Members, sec.Admins} {
+		if util.HasRole(members.Users, user.UserName) {
+			return true
+		}
+		for _, role := range members.Roles {
+			if util.HasRole(user.Roles, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Hands a notification over to the notifications service
+func sendNotification(template string, nr *NotificationRequest) error {
+	notifEndpoint, err := registry.GetServiceLocation("notifications")
+	if err != nil {
+		return err
+	}
+	nrJson, _, err := util.EncodeJsonData(nr)
+	if err != nil {
+		return err
+	}
+	reqUrl := notifEndpoint + "/api/v1/notifications/" + template + "/send"
+	request, err := http.NewRequest("POST", reqUrl, nrJson)
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Notification request failed: " + resp.Status)
+	}
+	return nil
+}
+
+//Shortens text to at most maxLength characters, at a word boundary
+func excerpt(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	runes := []rune(text)[:maxLength]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
@@ -31,13 +31,16 @@
 package wiki_service
 
 import (
+	"archive/zip"
 	"github.com/emicklei/go-restful"
 	. "github.com/rhinoman/wikifeat/common/database"
 	. "github.com/rhinoman/wikifeat/common/entities"
 	. "github.com/rhinoman/wikifeat/common/services"
 	"github.com/rhinoman/wikifeat/common/util"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 )
 
@@ -48,11 +51,42 @@ type wikiLinks struct {
 	PageIndex  *HatLink `json:"index,omitempty"`
 	Search     *HatLink `json:"search,omitempty"`
 	CreatePage *HatLink `json:"create_page,omitempty"`
+	Report     *HatLink `json:"report,omitempty"`
+	Export     *HatLink `json:"export,omitempty"`
+	Changes    *HatLink `json:"changes,omitempty"`
+}
+
+type changesLinks struct {
+	HatLinks
+	Atom *HatLink `json:"atom"`
+	Rss  *HatLink `json:"rss"`
+}
+
+type RecentChangesResponse struct {
+	Links   changesLinks   `json:"_links"`
+	PageNum int            `json:"pageNum"`
+	Changes []wikit.Change `json:"changes"`
+}
+
+type LinkReportResponse struct {
+	Links  HatLinks         `json:"_links"`
+	Report wikit.LinkReport `json:"report"`
+}
+
+type ImportResponse struct {
+	Links  HatLinks     `json:"_links"`
+	Result ImportResult `json:"result"`
+}
+
+type MediaWikiImportResponse struct {
+	Links  HatLinks              `json:"_links"`
+	Result MediaWikiImportResult `json:"result"`
 }
 
 type WikiRecordResponse struct {
-	Links      wikiLinks  `json:"_links"`
-	WikiRecord WikiRecord `json:"wiki_record"`
+	Links      wikiLinks     `json:"_links"`
+	WikiRecord WikiRecord    `json:"wiki_record"`
+	Redirect   *SlugRedirect `json:"redirect,omitempty"`
 }
 
 type WikiIndexResponse struct {
@@ -82,6 +116,12 @@ func (wc WikisController) Register(container *restful.Container) {
 	pc := PagesController{}
 	//Files is a subcontroller
 	fc := FileController{}
+	//Search is a subcontroller
+	sc := SearchController{}
+	//Tags is a subcontroller
+	tc := TagsController{}
+	//Templates is a subcontroller
+	tpc := TemplatesController{}
 	wikisWebService = new(restful.WebService)
 	wikisWebService.Filter(LogRequest).
 		Filter(AuthUser).
@@ -105,6 +145,23 @@ func (wc WikisController) Register(container *restful.Container) {
 		Reads(WikiRecord{}).
 		Writes(WikiRecordResponse{}))
 
+	wikisWebService.Route(wikisWebService.GET("/changes").To(wc.siteChanges).
+		Doc("List the recent changes to every wiki the user can read").
+		Operation("siteChanges").
+		Param(wikisWebService.QueryParameter("pageNum", "Page Number").DataType("integer")).
+		Param(wikisWebService.QueryParameter("numPerPage", "Number of records to return").DataType("integer")).
+		Writes(RecentChangesResponse{}))
+
+	wikisWebService.Route(wikisWebService.GET("/changes/atom").To(wc.siteChangesAtom).
+		Doc("Atom feed of the recent changes to every wiki the user can read").
+		Operation("siteChangesAtom").
+		Produces(atomMimeTypes...))
+
+	wikisWebService.Route(wikisWebService.GET("/changes/rss").To(wc.siteChangesRss).
+		Doc("RSS feed of the recent changes to every wiki the user can read").
+		Operation("siteChangesRss").
+		Produces(rssMimeTypes...))
+
 	wikisWebService.Route(wikisWebService.GET("/{wiki-id}").To(wc.read).
 		Doc("Fetch a Wiki Record").
 		Operation("read").
@@ -131,12 +188,69 @@ func (wc WikisController) Register(container *restful.Container) {
 		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
 		Writes(BooleanResponse{}))
 
+	wikisWebService.Route(wikisWebService.GET("/{wiki-id}/report").To(wc.report).
+		Doc("Report broken links, orphan pages and missing attachments").
+		Operation("report").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Writes(LinkReportResponse{}))
+
+	wikisWebService.Route(wikisWebService.GET("/{wiki-id}/changes").To(wc.changes).
+		Doc("List the recent changes to a Wiki").
+		Operation("changes").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(wikisWebService.QueryParameter("pageNum", "Page Number").DataType("integer")).
+		Param(wikisWebService.QueryParameter("numPerPage", "Number of records to return").DataType("integer")).
+		Writes(RecentChangesResponse{}))
+
+	wikisWebService.Route(wikisWebService.GET("/{wiki-id}/changes/atom").To(wc.changesAtom).
+		Doc("Atom feed of the recent changes to a Wiki").
+		Operation("changesAtom").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Produces(atomMimeTypes...))
+
+	wikisWebService.Route(wikisWebService.GET("/{wiki-id}/changes/rss").To(wc.changesRss).
+		Doc("RSS feed of the recent changes to a Wiki").
+		Operation("changesRss").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Produces(rssMimeTypes...))
+
+	wikisWebService.Route(wikisWebService.GET("/{wiki-id}/export").To(wc.export).
+		Doc("Export a Wiki's pages and files as a zip archive").
+		Operation("export").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(wikisWebService.QueryParameter("history", "Include page history").DataType("boolean")).
+		Produces("application/zip"))
+
+	wikisWebService.Route(wikisWebService.POST("/{wiki-id}/import").
+		Consumes("multipart/form-data").To(wc.importArchive).
+		Doc("Import a zip archive of markdown documents into a Wiki").
+		Operation("importArchive").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(wikisWebService.FormParameter("file-data", "The zip archive").DataType("file")).
+		Writes(ImportResponse{}))
+
+	wikisWebService.Route(wikisWebService.POST("/{wiki-id}/import/mediawiki").
+		Consumes("multipart/form-data").To(wc.importMediaWiki).
+		Doc("Import a MediaWiki XML export into a Wiki").
+		Operation("importMediaWiki").
+		Param(wikisWebService.PathParameter("wiki-id", "Wiki identifier").DataType("string")).
+		Param(wikisWebService.FormParameter("file-data", "The XML export").DataType("file")).
+		Writes(MediaWikiImportResponse{}))
+
 	//Add routes from pages to the wiki controller
 	pc.AddRoutes(wikisWebService)
 	//Add routes from files to the wiki controller
 	fc.AddRoutes(wikisWebService)
+	//Add routes from search to the wiki controller
+	sc.AddRoutes(wikisWebService)
+	//Add routes from tags to the wiki controller
+	tc.AddRoutes(wikisWebService)
+	//Add routes from templates to the wiki controller
+	tpc.AddRoutes(wikisWebService)
 	//Add the wiki controller to the container
 	container.Add(wikisWebService)
+	//User activity is gathered from the wikis, so it's served here too
+	ActivityController{}.Register(container)
 }
 
 func (wc WikisController) genWikiUri(wikiId string) string {
@@ -271,6 +385,10 @@ func (wc WikisController) readBySlug(request *restful.Request,
 	}
 	response.AddHeader("ETag", rev)
 	wr := wc.genRecordResponse(curUser.User, theWiki.Id, theWiki)
+	if theWiki.Slug != wikiSlug {
+		//The wiki has been renamed since
+		wr.Redirect = &SlugRedirect{From: wikiSlug, WikiSlug: theWiki.Slug}
+	}
 	SetAuth(response, curUser.Auth)
 	response.WriteEntity(wr)
 
@@ -322,6 +440,293 @@ func (wc WikisController) del(request *restful.Request,
 
 }
 
+//Get the link report for a wiki
+func (wc WikisController) report(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	report, err := new(WikiManager).LinkReport(wikiId, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(LinkReportResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: wc.genWikiUri(wikiId) + "/report", Method: "GET"},
+		},
+		Report: *report,
+	})
+}
+
+//List the recent changes to a wiki
+func (wc WikisController) changes(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	pageNum, numPerPage, err := changesPaging(request)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	changes, _, err := new(ChangesManager).Wiki(wikiId, pageNum, numPerPage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(wc.genChangesResponse(wc.genWikiUri(wikiId)+"/changes",
+		pageNum, changes))
+}
+
+//Atom feed of the recent changes to a wiki
+func (wc WikisController) changesAtom(request *restful.Request,
+	response *restful.Response) {
+	wc.wikiFeed(request, response, "atom")
+}
+
+//RSS feed of the recent changes to a wiki
+func (wc WikisController) changesRss(request *restful.Request,
+	response *restful.Response) {
+	wc.wikiFeed(request, response, "rss")
+}
+
+func (wc WikisController) wikiFeed(request *restful.Request,
+	response *restful.Response, format string) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	cm := new(ChangesManager)
+	changes, wr, err := cm.Wiki(wikiId, 1, feedLength, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	feed := cm.Feed(wr.Name+" - Recent Changes", "/app/wikis/"+wr.Slug,
+		wc.genWikiUri(wikiId)+"/changes/"+format, changes, false)
+	SetAuth(response, curUser.Auth)
+	writeFeed(feed, format, response)
+}
+
+//List the recent changes to every wiki the user can read
+func (wc WikisController) siteChanges(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	pageNum, numPerPage, err := changesPaging(request)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	changes, err := new(ChangesManager).Site(pageNum, numPerPage, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(wc.genChangesResponse(wc.wikiUri()+"/changes",
+		pageNum, changes))
+}
+
+//Atom feed of the recent changes to every wiki the user can read
+func (wc WikisController) siteChangesAtom(request *restful.Request,
+	response *restful.Response) {
+	wc.siteFeed(request, response, "atom")
+}
+
+//RSS feed of the recent changes to every wiki the user can read
+func (wc WikisController) siteChangesRss(request *restful.Request,
+	response *restful.Response) {
+	wc.siteFeed(request, response, "rss")
+}
+
+func (wc WikisController) siteFeed(request *restful.Request,
+	response *restful.Response, format string) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	cm := new(ChangesManager)
+	changes, err := cm.Site(1, feedLength, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	feed := cm.Feed("Recent Changes", "/app/wikis",
+		wc.wikiUri()+"/changes/"+format, changes, true)
+	SetAuth(response, curUser.Auth)
+	writeFeed(feed, format, response)
+}
+
+//Number of changes in a feed
+const feedLength = 50
+
+//The most changes listed in one page
+const maxChangesPerPage = 200
+
+var atomMimeTypes = []string{"application/atom+xml", "application/xml", "text/xml"}
+var rssMimeTypes = []string{"application/rss+xml", "application/xml", "text/xml"}
+
+func writeFeed(feed *wikit.Feed, format string, response *restful.Response) {
+	var err error
+	if format == "atom" {
+		response.AddHeader("Content-Type", atomMimeTypes[0]+"; charset=utf-8")
+		err = feed.WriteAtom(response)
+	} else {
+		response.AddHeader("Content-Type", rssMimeTypes[0]+"; charset=utf-8")
+		err = feed.WriteRSS(response)
+	}
+	//The headers are gone by now, so errors can only be logged
+	if err != nil {
+		log.Printf("Error writing %v feed: %v", format, err)
+	}
+}
+
+//Reads the page number and page size of a list of changes
+func changesPaging(request *restful.Request) (int, int, error) {
+	numPerPage, err := strconv.Atoi(request.QueryParameter("numPerPage"))
+	if err != nil {
+		numPerPage = 50
+	} else if numPerPage < 1 {
+		return 0, 0, BadRequestError()
+	} else if numPerPage > maxChangesPerPage {
+		numPerPage = maxChangesPerPage
+	}
+	pageNum, err := strconv.Atoi(request.QueryParameter("pageNum"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+	return pageNum, numPerPage, nil
+}
+
+func (wc WikisController) genChangesResponse(uri string, pageNum int,
+	changes []wikit.Change) RecentChangesResponse {
+	return RecentChangesResponse{
+		Links: changesLinks{
+			HatLinks: HatLinks{
+				Self: &HatLink{Href: uri + "{?pageNum,numPerPage}", Method: "GET",
+					Templated: true},
+			},
+			Atom: &HatLink{Href: uri + "/atom", Method: "GET"},
+			Rss:  &HatLink{Href: uri + "/rss", Method: "GET"},
+		},
+		PageNum: pageNum,
+		Changes: changes,
+	}
+}
+
+//Stream a zip archive of a wiki
+func (wc WikisController) export(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	includeHistory, err := strconv.ParseBool(request.QueryParameter("history"))
+	if err != nil {
+		includeHistory = false
+	}
+	wm := new(WikiManager)
+	wr := WikiRecord{}
+	if _, err := wm.Read(wikiId, &wr, curUser); err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.AddHeader("Content-Type", "application/zip")
+	response.AddHeader("Content-Disposition",
+		"attachment; filename=\""+wr.Slug+".zip\"")
+	//The headers are gone by now, so errors can only be logged
+	if err := wm.Export(wikiId, includeHistory, response, curUser); err != nil {
+		log.Printf("Error exporting wiki %v: %v", wikiId, err)
+	}
+}
+
+//Import a zip archive of markdown documents
+func (wc WikisController) importArchive(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	theFile, _, err := request.Request.FormFile("file-data")
+	if err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	defer theFile.Close()
+	size, err := theFile.Seek(0, os.SEEK_END)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	zr, err := zip.NewReader(theFile, size)
+	if err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	result, err := new(ImportManager).Import(wikiId, zr, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(ImportResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: wc.genWikiUri(wikiId) + "/import", Method: "POST"},
+		},
+		Result: *result,
+	})
+}
+
+//Import a MediaWiki XML export
+func (wc WikisController) importMediaWiki(request *restful.Request,
+	response *restful.Response) {
+	curUser := GetCurrentUser(request, response)
+	if curUser == nil {
+		Unauthenticated(request, response)
+		return
+	}
+	wikiId := request.PathParameter("wiki-id")
+	theFile, _, err := request.Request.FormFile("file-data")
+	if err != nil {
+		WriteBadRequestError(response)
+		return
+	}
+	defer theFile.Close()
+	result, err := new(ImportManager).ImportMediaWiki(wikiId, theFile, curUser)
+	if err != nil {
+		WriteError(err, response)
+		return
+	}
+	SetAuth(response, curUser.Auth)
+	response.WriteEntity(MediaWikiImportResponse{
+		Links: HatLinks{
+			Self: &HatLink{Href: wc.genWikiUri(wikiId) + "/import/mediawiki", Method: "POST"},
+		},
+		Result: *result,
+	})
+}
+
 //Generate a record response
 func (wc WikisController) genRecordResponse(curUser *User,
 	wikiId string, wikiRecord *WikiRecord) WikiRecordResponse {
@@ -366,6 +771,11 @@ func (wc WikisController) genWikiLinks(userRoles []string,
 	links.Self = &HatLink{Href: uri, Method: "GET"}
 	if admin || read || write {
 		links.PageIndex = &HatLink{Href: pageUri, Method: "GET"}
+		links.Export = &HatLink{Href: uri + "/export{?history}", Method: "GET",
+			Templated: true}
+		links.Search = &HatLink{Href: uri + "/search{?q}", Method: "GET",
+			Templated: true}
+		links.Changes = &HatLink{Href: uri + "/changes", Method: "GET"}
 	}
 	if admin || write {
 		links.CreatePage = &HatLink{Href: pageUri, Method: "POST"}
@@ -373,6 +783,7 @@ func (wc WikisController) genWikiLinks(userRoles []string,
 	if admin {
 		links.Update = &HatLink{Href: uri, Method: "PUT"}
 		links.Delete = &HatLink{Href: uri, Method: "DELETE"}
+		links.Report = &HatLink{Href: uri + "/report", Method: "GET"}
 	}
 	return links
 }
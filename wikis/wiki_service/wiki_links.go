@@ -0,0 +1,195 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wiki_service
+
+import (
+	"github.com/rhinoman/go-slugification"
+	. "github.com/rhinoman/wikifeat/common/database"
+	. "github.com/rhinoman/wikifeat/common/entities"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"html"
+	"log"
+	"regexp"
+)
+
+var pageHrefRegexp = regexp.MustCompile(`href="/app/wikis/([^/"?#]+)/pages/([^/"?#]+)(?:#[^"]*)?"`)
+
+//Resolves [[wiki links]] into page hrefs
+type linkResolver struct {
+	wikiId  string
+	curUser *CurrentUserInfo
+	//wiki ids, keyed by wiki slug
+	wikiIds map[string]string
+	//the current wiki's slug
+	wikiSlug string
+}
+
+func newLinkResolver(wiki string, curUser *CurrentUserInfo) *linkResolver {
+	lr := &linkResolver{
+		wikiId:  wiki,
+		curUser: curUser,
+		wikiIds: make(map[string]string),
+	}
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).Read(wiki, &wr, curUser); err == nil {
+		lr.wikiSlug = wr.Slug
+		lr.wikiIds[wr.Slug] = wiki
+	}
+	return lr
+}
+
+//Replaces the wiki links in a markdown document with html links
+//Returns the new markdown and the list of link targets
+func (lr *linkResolver) resolve(mdText string) (string, []wikit.PageLink) {
+	links := []wikit.PageLink{}
+	resolved := wikit.ReplaceWikiLinks(mdText, func(ref wikit.WikiLinkRef) string {
+		link, wikiSlug := lr.resolveLink(ref)
+		links = addLink(links, link)
+		href := "/app/wikis/" + wikiSlug + "/pages/" + link.Slug
+		label := html.EscapeString(ref.Label)
+		if link.PageId == "" {
+			return `<a href="` + href + `" data-wikilink="missing" ` +
+				`title="Create this page">` + label + `</a>`
+		}
+		return `<a href="` + href + `" data-wikilink="page">` + label + `</a>`
+	})
+	return resolved, links
+}
+
+//Adds the targets of html links to other wiki pages to a list of links
+func (lr *linkResolver) resolveHrefs(htmlText string,
+	links []wikit.PageLink) []wikit.PageLink {
+	for _, match := range pageHrefRegexp.FindAllStringSubmatch(htmlText, -1) {
+		wikiSlug, pageSlug := match[1], match[2]
+		if hasLink(links, lr.wikiIdForSlug(wikiSlug), pageSlug) {
+			continue
+		}
+		link := lr.lookupPage(wikiSlug, pageSlug)
+		links = addLink(links, link)
+	}
+	return links
+}
+
+//Looks up the target of a wiki link
+//Returns the link target and the slug of the wiki it belongs to
+func (lr *linkResolver) resolveLink(ref wikit.WikiLinkRef) (wikit.PageLink, string) {
+	wikiSlug := ref.WikiSlug
+	if wikiSlug == "" {
+		wikiSlug = lr.wikiSlug
+	}
+	link := lr.lookupPage(wikiSlug, slugification.Slugify(ref.Title))
+	if link.PageId == "" {
+		link.Title = ref.Title
+	}
+	return link, wikiSlug
+}
+
+//Finds a page by wiki and page slug
+//The returned link has an empty page id if the page doesn't exist
+func (lr *linkResolver) lookupPage(wikiSlug string, pageSlug string) wikit.PageLink {
+	link := wikit.PageLink{
+		WikiId: lr.wikiIdForSlug(wikiSlug),
+		Slug:   pageSlug,
+	}
+	if link.WikiId == "" {
+		return link
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(link.WikiId), lr.curUser.Auth)
+	page := wikit.Page{}
+	if _, err := theWiki.ReadPageBySlug(link.Slug, &page); err == nil {
+		link.PageId = page.Id
+		link.Title = page.Title
+	} else if _, err := theWiki.ReadPageByPreviousSlug(link.Slug, &page); err == nil {
+		//Links to a renamed page still work
+		link.PageId = page.Id
+		link.Title = page.Title
+	}
+	return link
+}
+
+//Renders the pages of a wiki which link to a missing page again,
+//once a page with that slug exists, so their links to it resolve
+func relinkMissing(wiki string, slug string, curUser *CurrentUserInfo) {
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+	pageIds, err := theWiki.GetMissingLinkPages(wiki, slug)
+	if err != nil {
+		log.Printf("Error finding links to page %v: %v", slug, err)
+		return
+	}
+	relinkPages(wiki, pageIds, curUser)
+}
+
+//Renders pages again without recording a new revision
+func relinkPages(wiki string, pageIds []string, curUser *CurrentUserInfo) {
+	pm := new(PageManager)
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(wiki), curUser.Auth)
+	for _, pageId := range pageIds {
+		page := wikit.Page{}
+		rev, err := theWiki.ReadPage(pageId, &page)
+		if err == nil {
+			pm.renderPage(wiki, &page, curUser)
+			_, err = theWiki.UpdateRendering(pageId, rev,
+				page.Content.Formatted, page.Links)
+		}
+		if err != nil {
+			log.Printf("Error updating links of page %v: %v", pageId, err)
+		}
+	}
+}
+
+func hasLink(links []wikit.PageLink, wikiId string, slug string) bool {
+	for _, link := range links {
+		if link.WikiId == wikiId && link.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func addLink(links []wikit.PageLink, link wikit.PageLink) []wikit.PageLink {
+	if hasLink(links, link.WikiId, link.Slug) {
+		return links
+	}
+	return append(links, link)
+}
+
+func (lr *linkResolver) wikiIdForSlug(wikiSlug string) string {
+	if id, ok := lr.wikiIds[wikiSlug]; ok {
+		return id
+	}
+	wr := WikiRecord{}
+	if _, err := new(WikiManager).ReadBySlug(wikiSlug, &wr, lr.curUser); err != nil {
+		lr.wikiIds[wikiSlug] = ""
+	} else {
+		lr.wikiIds[wikiSlug] = wr.Id
+	}
+	return lr.wikiIds[wikiSlug]
+}
@@ -39,6 +39,7 @@ import (
 	. "github.com/rhinoman/wikifeat/common/entities"
 	"github.com/rhinoman/wikifeat/common/util"
 	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"io"
 	"log"
 	"net/url"
 	"strconv"
@@ -103,6 +104,9 @@ func (wm *WikiManager) Create(id string, wr *WikiRecord,
 	wr.CreatedAt = time.Now().UTC()
 	wr.ModifiedAt = time.Now().UTC()
 	wr.Type = "wiki_record"
+	//A new wiki has no slug history, or it could take over another's
+	wr.PreviousSlugs = nil
+	wr.RenamedAt = nil
 	if err := wr.Validate(); err != nil {
 		return "", err
 	}
@@ -218,10 +222,27 @@ func (wm *WikiManager) ReadBySlug(slug string, wikiRecord *WikiRecord,
 	if err != nil {
 		return "", err
 	}
+	if len(response.Rows) == 0 {
+		//The wiki may have been renamed
+		err = cDb.GetView("wiki_query", "getWikiByPreviousSlug",
+			&response, wikit.SetKey(slug))
+		if err != nil {
+			return "", err
+		}
+	}
 	if len(response.Rows) > 0 {
-		*wikiRecord = response.Rows[0].Value.WikiRecord
-		wikiRecord.Id = response.Rows[0].Id
-		return response.Rows[0].Value.Rev, nil
+		//If more than one wiki once had this slug, the one renamed
+		//most recently wins
+		latest := response.Rows[0]
+		for _, row := range response.Rows[1:] {
+			if wikit.RenamedAfter(row.Value.WikiRecord.RenamedAt,
+				latest.Value.WikiRecord.RenamedAt) {
+				latest = row
+			}
+		}
+		*wikiRecord = latest.Value.WikiRecord
+		wikiRecord.Id = latest.Id
+		return latest.Value.Rev, nil
 	} else {
 		return "", NotFoundError()
 	}
@@ -258,6 +279,13 @@ func (wm *WikiManager) Update(id string, rev string,
 	wr.AllowGuest = updateRecord.AllowGuest
 	wr.ModifiedAt = time.Now().UTC()
 	wr.Slug = slugification.Slugify(wr.Name)
+	//Remember the old slug so links to it can be redirected
+	wr.PreviousSlugs = wikit.AddPreviousSlug(wr.PreviousSlugs,
+		prevDocument.Slug, wr.Slug)
+	if wr.Slug != prevDocument.Slug {
+		renamedAt := wr.ModifiedAt
+		wr.RenamedAt = &renamedAt
+	}
 	if err = wr.Validate(); err != nil {
 		return "", err
 	}
@@ -351,3 +379,65 @@ func (wm *WikiManager) GetWikiList(pageNum int, numPerPage int, memberOnly bool,
 	}
 	return nil
 }
+
+//Brings the design documents of the main database and of every
+//wiki database up to date
+func (wm *WikiManager) UpdateWikiDatabases() error {
+	wlr := WikiListResponse{}
+	mainDb := Connection.SelectDB(MainDbName(), AdminAuth)
+	if err := UpdateMainDatabase(); err != nil {
+		return err
+	}
+	//The main database holds the global page templates
+	if err := wikit.InitTemplateDb(mainDb); err != nil {
+		return err
+	}
+	if err := mainDb.GetView("wiki_query", "getWikis", &wlr, nil); err != nil {
+		return err
+	}
+	for _, row := range wlr.Rows {
+		dbName := WikiDbName(row.Id)
+		db := Connection.SelectDB(dbName, AdminAuth)
+		if err := wikit.UpdateDesignDocs(db, dbName); err != nil {
+			log.Printf("Error updating wiki database %v: %v", dbName, err)
+		}
+	}
+	return nil
+}
+
+//Reports broken links, orphan pages and missing attachments in a wiki
+//Only wiki admins may run this report
+func (wm *WikiManager) LinkReport(id string,
+	curUser *CurrentUserInfo) (*wikit.LinkReport, error) {
+	if !isWikiAdmin(id, curUser) {
+		return nil, NotAdminError()
+	}
+	wr := WikiRecord{}
+	if _, err := wm.Read(id, &wr, curUser); err != nil {
+		return nil, err
+	}
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(id), curUser.Auth)
+	report, err := theWiki.GetLinkReport(id)
+	if err != nil {
+		return nil, err
+	}
+	//The home page is reachable from the wiki itself
+	orphans := []wikit.PageIndexEntry{}
+	for _, page := range report.OrphanPages {
+		if page.Id != wr.HomePageId {
+			orphans = append(orphans, page)
+		}
+	}
+	report.OrphanPages = orphans
+	return report, nil
+}
+
+//Writes a zip archive of a wiki's current pages and files to w.
+//Pages restricted from the current user are left out.
+func (wm *WikiManager) Export(id string, includeHistory bool, w io.Writer,
+	curUser *CurrentUserInfo) error {
+	theWiki := wikit.SelectWiki(Connection, wikiDbString(id), curUser.Auth)
+	return theWiki.Export(w, includeHistory, func(page *wikit.Page) bool {
+		return canAccess(id, page.Restriction, curUser)
+	})
+}
@@ -31,6 +31,8 @@
 package wiki_service_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
 	"github.com/rhinoman/couchdb-go"
 	"github.com/rhinoman/wikifeat/common/config"
@@ -38,7 +40,9 @@ import (
 	. "github.com/rhinoman/wikifeat/common/entities"
 	"github.com/rhinoman/wikifeat/users/user_service"
 	"github.com/rhinoman/wikifeat/wikis/wiki_service"
+	"github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
 	"github.com/twinj/uuid"
+	"strings"
 	"testing"
 	"time"
 )
@@ -152,8 +156,9 @@ func doWikiTest(t *testing.T) {
 		t.Error(err)
 	}
 	otherWikiRecord := WikiRecord{
-		Name:        "Megasoft Executives",
-		Description: "Executives only",
+		Name:          "Megasoft Executives",
+		Description:   "Executives only",
+		PreviousSlugs: []string{"megasoft-intranet"},
 	}
 	rev, err = wm.Create(otherWikiId, &otherWikiRecord, curUser)
 	if err != nil {
@@ -187,6 +192,27 @@ func doWikiTest(t *testing.T) {
 	if err == nil {
 		t.Error("Should have been an error!")
 	}
+	//Rename a wiki, then find it by its old slug
+	oRwr = new(WikiRecord)
+	rev, err = wm.Read(otherWikiId, oRwr, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	oldSlug := oRwr.Slug
+	oRwr.Name = "Megasoft Board"
+	if _, err = wm.Update(otherWikiId, rev, oRwr, curUser); err != nil {
+		t.Error(err)
+	}
+	movedWr := new(WikiRecord)
+	if _, err = wm.ReadBySlug(oldSlug, movedWr, curUser); err != nil {
+		t.Error(err)
+	} else if movedWr.Id != otherWikiId || movedWr.Slug != "megasoft-board" {
+		t.Errorf("Old slug should find the renamed wiki: %v", *movedWr)
+	}
+	//New wikis can't claim previous slugs
+	if _, err = wm.ReadBySlug("megasoft-intranet", new(WikiRecord), curUser); err == nil {
+		t.Error("A new wiki shouldn't keep the previous slugs it was created with")
+	}
 
 	//Test List
 	wlr := wiki_service.WikiListResponse{}
@@ -210,6 +236,39 @@ func doWikiTest(t *testing.T) {
 		t.Errorf("Wrong length: %v", len(nextWlr.Rows))
 	}
 	t.Logf("Wiki List: %v", nextWlr)
+	//Test MediaWiki Import
+	dump := `<mediawiki><page><title>Imported_Page</title><ns>0</ns>
+<revision><timestamp>2015-06-01T10:00:00Z</timestamp>
+<contributor><username>Alice</username></contributor><text>== One ==</text></revision>
+<revision><timestamp>2015-06-02T10:00:00Z</timestamp>
+<contributor><username>Bob</username></contributor><text>'''Two'''</text></revision>
+</page></mediawiki>`
+	mwResult, err := new(wiki_service.ImportManager).ImportMediaWiki(wikiId,
+		strings.NewReader(dump), curUser)
+	if err != nil {
+		t.Error(err)
+	} else if len(mwResult.Pages) != 1 || mwResult.Pages[0].Error != "" {
+		t.Errorf("MediaWiki import failed: %v", mwResult)
+	} else {
+		imported := wikit.Page{}
+		_, err = pm.Read(wikiId, mwResult.Pages[0].PageId, &imported, curUser)
+		if err != nil {
+			t.Error(err)
+		}
+		if imported.LastEditor != "Bob" || imported.Content.Raw != "**Two**\n" {
+			t.Errorf("Unexpected imported page: %v", imported)
+		}
+	}
+	//Test Export
+	archive := bytes.Buffer{}
+	err = wm.Export(wikiId, true, &archive, curUser)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Errorf("Export is not a zip: %v", err)
+	}
 	//Delete Wiki
 	err = wm.Delete(wikiId, curUser)
 	if err != nil {
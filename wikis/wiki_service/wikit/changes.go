@@ -0,0 +1,221 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Recent changes: page edits, creations, deletions and comments by time
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//Kinds of change
+const (
+	ChangeCreated   = "created"
+	ChangeEdited    = "edited"
+	ChangeDeleted   = "deleted"
+	ChangeCommented = "commented"
+	ChangeUploaded  = "uploaded"
+)
+
+//Records a deleted page, which otherwise leaves nothing behind
+type Deletion struct {
+	Id          string       `json:"id,omitempty"`
+	DocType     string       `json:"type"`
+	PageId      string       `json:"pageId"`
+	Title       string       `json:"title"`
+	Slug        string       `json:"slug"`
+	Editor      string       `json:"editor"` //who deleted the page
+	Timestamp   time.Time    `json:"timestamp"`
+	Lineage     []string     `json:"lineage"`
+	Restriction *Restriction `json:"restriction,omitempty"`
+}
+
+type Change struct {
+	Type         string       `json:"type"`
+	PageId       string       `json:"pageId"`
+	Title        string       `json:"title"` //the page title at the time of the change
+	Slug         string       `json:"slug,omitempty"`
+	User         string       `json:"user"`
+	Timestamp    time.Time    `json:"timestamp"`
+	DocumentId   string       `json:"documentId"` //the page revision, comment or deletion record
+	RevertedFrom string       `json:"revertedFrom,omitempty"`
+	Restriction  *Restriction `json:"restriction,omitempty"` //of a deleted page
+	//Set when changes to several wikis are listed together
+	Wiki     string `json:"wiki,omitempty"`
+	WikiSlug string `json:"wikiSlug,omitempty"`
+	WikiName string `json:"wikiName,omitempty"`
+}
+
+type ChangeViewResponse struct {
+	ViewResponse
+	Rows []ChangeViewResult `json:"rows,omitempty"`
+}
+
+type ChangeViewResult struct {
+	Id    string `json:"id"`
+	Key   string `json:"key"`
+	Value Change `json:"value"`
+}
+
+//Records the deletion of a page for the recent changes
+func (wiki *Wiki) RecordDeletion(page *Page, id string, editor string) (string, error) {
+	deletion := Deletion{
+		DocType:     "deletion",
+		PageId:      id,
+		Title:       page.Title,
+		Slug:        page.Slug,
+		Editor:      editor,
+		Timestamp:   time.Now().UTC(),
+		Lineage:     page.Lineage,
+		Restriction: page.Restriction,
+	}
+	return wiki.db.Save(&deletion, getUuid(), "")
+}
+
+//Gets the changes made to the wiki, newest first
+func (wiki *Wiki) GetRecentChanges(pageNum int,
+	numPerPage int) (*ChangeViewResponse, error) {
+	params := url.Values{}
+	params.Add("descending", "true")
+	if numPerPage != 0 {
+		params.Add("limit", strconv.Itoa(numPerPage))
+	}
+	skip := numPerPage * (pageNum - 1)
+	if skip > 0 {
+		params.Add("skip", strconv.Itoa(skip))
+	}
+	return wiki.getChanges("getRecentChanges", &params)
+}
+
+//Gets the pages a user created or edited, the comments they wrote and
+//the files they uploaded, newest first
+func (wiki *Wiki) GetUserActivity(user string, pageNum int,
+	numPerPage int) (*ChangeViewResponse, error) {
+	params := SetKeys([]string{user, "{}"}, []string{user})
+	if numPerPage != 0 {
+		params.Add("limit", strconv.Itoa(numPerPage))
+	}
+	skip := numPerPage * (pageNum - 1)
+	if skip > 0 {
+		params.Add("skip", strconv.Itoa(skip))
+	}
+	return wiki.getChanges("getUserActivity", params)
+}
+
+func (wiki *Wiki) getChanges(view string,
+	params *url.Values) (*ChangeViewResponse, error) {
+	response := ChangeViewResponse{}
+	if err := wiki.db.GetView("wikit", view, &response, params); err != nil {
+		return nil, err
+	}
+	for i := range response.Rows {
+		response.Rows[i].Value.DocumentId = response.Rows[i].Id
+	}
+	return &response, nil
+}
+
+//Fills in the current slug and title of the pages changed, and leaves
+//out changes to pages that visible rejects or that no longer exist.
+//Restrictions are cleared from the changes returned.
+func (wiki *Wiki) ResolveChanges(rows []ChangeViewResult,
+	visible func(*Restriction) bool) ([]Change, error) {
+	pageIds := []string{}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		pageId := row.Value.PageId
+		if row.Value.Type != ChangeDeleted && pageId != "" && !seen[pageId] {
+			seen[pageId] = true
+			pageIds = append(pageIds, pageId)
+		}
+	}
+	pages := make(map[string]*Page)
+	if len(pageIds) > 0 {
+		mpr := MultiPageResponse{}
+		if err := wiki.ReadMultiplePages(pageIds, &mpr); err != nil {
+			return nil, err
+		}
+		for i, row := range mpr.Rows {
+			if row.Doc.DocType == "page" {
+				pages[row.Key] = &mpr.Rows[i].Doc
+			}
+		}
+	}
+	changes := []Change{}
+	for _, row := range rows {
+		change := row.Value
+		if change.Type == ChangeDeleted || change.PageId == "" {
+			//Deleted pages keep their last restriction; files have none
+			if !visible(change.Restriction) {
+				continue
+			}
+		} else if page, ok := pages[change.PageId]; !ok || !visible(page.Restriction) {
+			continue
+		} else {
+			change.Slug = page.Slug
+			if change.Title == "" {
+				change.Title = page.Title
+			}
+		}
+		change.Restriction = nil
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+//Merges lists of changes, newest first, and returns the requested page
+//of the result.  Each list should hold at least pageNum * numPerPage
+//of its newest changes.
+func MergeChanges(lists [][]Change, pageNum int, numPerPage int) []Change {
+	changes := []Change{}
+	for _, list := range lists {
+		changes = append(changes, list...)
+	}
+	sort.Stable(byChangeTime(changes))
+	skip := numPerPage * (pageNum - 1)
+	if skip >= len(changes) {
+		return []Change{}
+	} else if skip > 0 {
+		changes = changes[skip:]
+	}
+	if numPerPage > 0 && len(changes) > numPerPage {
+		changes = changes[:numPerPage]
+	}
+	return changes
+}
+
+type byChangeTime []Change
+
+func (c byChangeTime) Len() int           { return len(c) }
+func (c byChangeTime) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byChangeTime) Less(i, j int) bool { return c[i].Timestamp.After(c[j].Timestamp) }
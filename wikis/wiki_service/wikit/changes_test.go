@@ -0,0 +1,64 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+	"time"
+)
+
+func TestMergeChanges(t *testing.T) {
+	at := func(minute int) time.Time {
+		return time.Date(2016, 3, 14, 15, minute, 0, 0, time.UTC)
+	}
+	lists := [][]Change{
+		{{DocumentId: "a5", Timestamp: at(5)}, {DocumentId: "a2", Timestamp: at(2)}},
+		{{DocumentId: "b4", Timestamp: at(4)}, {DocumentId: "b3", Timestamp: at(3)}},
+		{},
+	}
+	expect := func(changes []Change, ids ...string) {
+		if len(changes) != len(ids) {
+			t.Errorf("Expected %v, got %v", ids, changes)
+			return
+		}
+		for i, id := range ids {
+			if changes[i].DocumentId != id {
+				t.Errorf("Expected %v, got %v", ids, changes)
+				return
+			}
+		}
+	}
+	expect(MergeChanges(lists, 1, 3), "a5", "b4", "b3")
+	expect(MergeChanges(lists, 2, 3), "a2")
+	expect(MergeChanges(lists, 3, 3))
+	expect(MergeChanges(lists, 1, 0), "a5", "b4", "b3", "a2")
+}
@@ -0,0 +1,305 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Diffing of page content
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+//A run of tokens that are equal, inserted or deleted
+type DiffChunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+//Differences between two revisions of a page
+type PageDiff struct {
+	From     DiffRevision `json:"from"`
+	To       DiffRevision `json:"to"`
+	LineDiff []DiffChunk  `json:"lineDiff"`
+	WordDiff []DiffChunk  `json:"wordDiff"`
+	HtmlDiff string       `json:"htmlDiff"`
+}
+
+type DiffRevision struct {
+	DocumentId string    `json:"documentId"`
+	Editor     string    `json:"editor"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+//A single step in an edit script
+type diffEdit struct {
+	op    string
+	token string
+}
+
+var wordTokens = regexp.MustCompile(`\s+|[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_]`)
+var htmlTokens = regexp.MustCompile(`<[^>]*>|[^<]+`)
+
+//Compares two revisions of a page.
+//The 'to' document defaults to the current version of the page.
+//Both documents must belong to the page
+func (wiki *Wiki) DiffPage(pageId string, fromId string,
+	toId string) (*PageDiff, error) {
+	if toId == "" {
+		toId = pageId
+	}
+	fromPage := Page{}
+	toPage := Page{}
+	if _, err := wiki.ReadRevision(pageId, fromId, &fromPage); err != nil {
+		return nil, err
+	}
+	if _, err := wiki.ReadRevision(pageId, toId, &toPage); err != nil {
+		return nil, err
+	}
+	return &PageDiff{
+		From:     diffRevision(fromId, &fromPage),
+		To:       diffRevision(toId, &toPage),
+		LineDiff: DiffLines(fromPage.Content.Raw, toPage.Content.Raw),
+		WordDiff: DiffWords(fromPage.Content.Raw, toPage.Content.Raw),
+		HtmlDiff: DiffHtml(fromPage.Content.Formatted, toPage.Content.Formatted),
+	}, nil
+}
+
+func diffRevision(docId string, page *Page) DiffRevision {
+	return DiffRevision{
+		DocumentId: docId,
+		Editor:     page.LastEditor,
+		Timestamp:  page.Timestamp,
+	}
+}
+
+//Line by line diff of two texts
+func DiffLines(from string, to string) []DiffChunk {
+	return chunkEdits(diffTokens(SplitLines(from), SplitLines(to)))
+}
+
+//Word by word diff of two texts
+func DiffWords(from string, to string) []DiffChunk {
+	return chunkEdits(diffTokens(wordTokens.FindAllString(from, -1),
+		wordTokens.FindAllString(to, -1)))
+}
+
+//Diffs two html documents.
+//Returns the 'to' document with deleted text wrapped in <del>
+//and inserted text wrapped in <ins>.
+func DiffHtml(from string, to string) string {
+	edits := diffTokens(tokenizeHtml(from), tokenizeHtml(to))
+	var out []string
+	var run []string
+	flush := func(op string) {
+		if len(run) == 0 {
+			return
+		}
+		tag := "ins"
+		if op == DiffDelete {
+			tag = "del"
+		}
+		out = append(out, "<"+tag+" class=\"diff\">"+
+			strings.Join(run, "")+"</"+tag+">")
+		run = nil
+	}
+	prevOp := DiffEqual
+	for _, edit := range edits {
+		if edit.op != prevOp {
+			flush(prevOp)
+			prevOp = edit.op
+		}
+		isTag := strings.HasPrefix(edit.token, "<")
+		switch {
+		case edit.op == DiffEqual:
+			out = append(out, edit.token)
+		case isTag && edit.op == DiffInsert:
+			//Keep the new document's structure intact
+			flush(edit.op)
+			out = append(out, edit.token)
+		case isTag && edit.op == DiffDelete:
+			//Markup from the old document is dropped
+			flush(edit.op)
+		default:
+			run = append(run, edit.token)
+		}
+	}
+	flush(prevOp)
+	return strings.Join(out, "")
+}
+
+//Splits text into lines, keeping the line endings
+func SplitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func tokenizeHtml(html string) []string {
+	var tokens []string
+	for _, tok := range htmlTokens.FindAllString(html, -1) {
+		if strings.HasPrefix(tok, "<") {
+			tokens = append(tokens, tok)
+		} else {
+			tokens = append(tokens, wordTokens.FindAllString(tok, -1)...)
+		}
+	}
+	return tokens
+}
+
+//Merges consecutive edits with the same operation
+func chunkEdits(edits []diffEdit) []DiffChunk {
+	chunks := []DiffChunk{}
+	for _, edit := range edits {
+		if last := len(chunks) - 1; last >= 0 && chunks[last].Op == edit.op {
+			chunks[last].Text += edit.token
+		} else {
+			chunks = append(chunks, DiffChunk{Op: edit.op, Text: edit.token})
+		}
+	}
+	return chunks
+}
+
+//Computes the shortest edit script turning a into b
+func diffTokens(a []string, b []string) []diffEdit {
+	var edits []diffEdit
+	myers(a, b, &edits)
+	return edits
+}
+
+//Myers' algorithm in its linear space variant: the middle snake of
+//the shortest edit script is found by searching from both ends at
+//once, then the parts before and after it are diffed the same way
+func myers(a []string, b []string, edits *[]diffEdit) {
+	//Trim the common prefix and suffix, they're cheap to find
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	appendEdits(edits, DiffEqual, a[:prefix])
+	common := a[len(a)-suffix:]
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+	switch {
+	case len(a) == 0:
+		appendEdits(edits, DiffInsert, b)
+	case len(b) == 0:
+		appendEdits(edits, DiffDelete, a)
+	default:
+		//With the ends trimmed, at least two edits remain, so the
+		//parts on either side of the snake are smaller problems
+		x, y, u, v := middleSnake(a, b)
+		myers(a[:x], b[:y], edits)
+		appendEdits(edits, DiffEqual, a[x:u])
+		myers(a[u:], b[v:], edits)
+	}
+	appendEdits(edits, DiffEqual, common)
+}
+
+func appendEdits(edits *[]diffEdit, op string, tokens []string) {
+	for _, tok := range tokens {
+		*edits = append(*edits, diffEdit{op, tok})
+	}
+}
+
+//Finds the snake in the middle of a shortest edit script of a and b.
+//Returns its start (x, y) and end (u, v)
+func middleSnake(a []string, b []string) (int, int, int, int) {
+	n := len(a)
+	m := len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	offset := max + 1
+	//Furthest reaching x on each diagonal, searching forwards from
+	//the start and backwards from the end (counted from the end)
+	vf := make([]int, 2*max+3)
+	vb := make([]int, 2*max+3)
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			//The backward search is on diagonal delta-k
+			if odd && k >= delta-(d-1) && k <= delta+(d-1) &&
+				x+vb[offset+delta-k] >= n {
+				return x0, y0, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+			if !odd && delta-k >= -d && delta-k <= d &&
+				x+vf[offset+delta-k] >= n {
+				return n - x, m - y, n - x0, m - y0
+			}
+		}
+	}
+	//Not reached, the searches always meet
+	return 0, 0, n, m
+}
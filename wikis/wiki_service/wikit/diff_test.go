@@ -0,0 +1,158 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+//Reassembles the from and to texts from a diff
+func unDiff(chunks []DiffChunk) (string, string) {
+	var from, to []string
+	for _, chunk := range chunks {
+		if chunk.Op != DiffInsert {
+			from = append(from, chunk.Text)
+		}
+		if chunk.Op != DiffDelete {
+			to = append(to, chunk.Text)
+		}
+	}
+	return strings.Join(from, ""), strings.Join(to, "")
+}
+
+func TestDiffLines(t *testing.T) {
+	from := "one\ntwo\nthree\nfour\n"
+	to := "one\nthree\nthree and a half\nfour\nfive"
+	chunks := DiffLines(from, to)
+	expected := []DiffChunk{
+		{Op: DiffEqual, Text: "one\n"},
+		{Op: DiffDelete, Text: "two\n"},
+		{Op: DiffEqual, Text: "three\n"},
+		{Op: DiffInsert, Text: "three and a half\n"},
+		{Op: DiffEqual, Text: "four\n"},
+		{Op: DiffInsert, Text: "five"},
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Wrong number of chunks: %v", chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk != expected[i] {
+			t.Errorf("Chunk %v should be %v, was %v", i, expected[i], chunk)
+		}
+	}
+	if f, tt := unDiff(chunks); f != from || tt != to {
+		t.Errorf("Diff doesn't reproduce its inputs: %q, %q", f, tt)
+	}
+	if chunks = DiffLines("", ""); len(chunks) != 0 {
+		t.Errorf("Empty diff should have no chunks: %v", chunks)
+	}
+}
+
+//Length of the longest common subsequence of two lists of lines
+func lcsLength(a []string, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomText := func() string {
+		lines := make([]string, rnd.Intn(40))
+		for i := range lines {
+			lines[i] = string('a'+rune(rnd.Intn(4))) + "\n"
+		}
+		return strings.Join(lines, "")
+	}
+	for i := 0; i < 500; i++ {
+		from := randomText()
+		to := randomText()
+		chunks := DiffLines(from, to)
+		if f, tt := unDiff(chunks); f != from || tt != to {
+			t.Fatalf("Diff doesn't reproduce its inputs: %q, %q", f, tt)
+		}
+		equal := 0
+		for _, chunk := range chunks {
+			if chunk.Op == DiffEqual {
+				equal += len(SplitLines(chunk.Text))
+			}
+		}
+		if lcs := lcsLength(SplitLines(from), SplitLines(to)); equal != lcs {
+			t.Fatalf("Diff of %q and %q keeps %v lines, should keep %v",
+				from, to, equal, lcs)
+		}
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	from := "The quick brown fox jumps over the dog."
+	to := "The quick red fox jumped over the lazy dog."
+	chunks := DiffWords(from, to)
+	if f, tt := unDiff(chunks); f != from || tt != to {
+		t.Errorf("Diff doesn't reproduce its inputs: %q, %q", f, tt)
+	}
+	changes := 0
+	for _, chunk := range chunks {
+		if chunk.Op != DiffEqual {
+			changes++
+		}
+	}
+	if changes != 5 {
+		t.Errorf("Should be 5 changed chunks, was %v: %v", changes, chunks)
+	}
+}
+
+func TestDiffHtml(t *testing.T) {
+	from := "<h1>About</h1>\n<p>Hello there world</p>"
+	to := "<h1>About us</h1>\n<ul><li>Hello world</li></ul>"
+	result := DiffHtml(from, to)
+	expected := "<h1>About<ins class=\"diff\"> us</ins></h1>\n" +
+		"<ul><li>Hello <del class=\"diff\">there </del>world</li></ul>"
+	if result != expected {
+		t.Errorf("Bad html diff: %v", result)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Private page drafts
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"time"
+)
+
+//A user's unpublished edit of a page.
+//Each user has at most one draft per page.
+type Draft struct {
+	Id        string      `json:"id,omitempty"`
+	DocType   string      `json:"type"`
+	Owner     string      `json:"owner"`   //a user name
+	PageId    string      `json:"pageId"`  //the page being edited
+	BaseRev   string      `json:"baseRev"` //the page revision the draft started from
+	Title     string      `json:"title"`
+	Content   PageContent `json:"content"`
+	Tags      []string    `json:"tags"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+func DraftId(pageId string, user string) string {
+	return "draft:" + pageId + ":" + user
+}
+
+//Saves a user's draft of a page, replacing any previous draft
+func (wiki *Wiki) SaveDraft(draft *Draft, pageId string,
+	user string) (string, error) {
+	id := DraftId(pageId, user)
+	rev := ""
+	oldDraft := Draft{}
+	if oldRev, err := wiki.ReadDraft(pageId, user, &oldDraft); err == nil {
+		rev = oldRev
+		if draft.BaseRev == "" {
+			draft.BaseRev = oldDraft.BaseRev
+		}
+	} else if cErr, ok := err.(*Error); !ok || cErr.StatusCode != 404 {
+		return "", err
+	}
+	draft.DocType = "draft"
+	draft.Owner = user
+	draft.PageId = pageId
+	draft.Timestamp = time.Now().UTC()
+	draft.Tags = NormalizeTags(draft.Tags)
+	return wiki.db.Save(draft, id, rev)
+}
+
+//Reads a user's draft of a page
+func (wiki *Wiki) ReadDraft(pageId string, user string,
+	draft *Draft) (string, error) {
+	id := DraftId(pageId, user)
+	rev, err := wiki.db.Read(id, draft, nil)
+	if err != nil {
+		return "", err
+	} else if draft.DocType != "draft" || draft.Owner != user {
+		return "", &Error{
+			StatusCode: 404,
+			Reason:     "Draft not found",
+		}
+	}
+	draft.Id = id
+	return rev, nil
+}
+
+//Discards a user's draft of a page
+func (wiki *Wiki) DeleteDraft(pageId string, user string) (string, error) {
+	draft := Draft{}
+	rev, err := wiki.ReadDraft(pageId, user, &draft)
+	if err != nil {
+		return "", err
+	}
+	return wiki.db.Delete(draft.Id, rev)
+}
@@ -0,0 +1,244 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Wiki export
+
+import (
+	"archive/zip"
+	"bytes"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AllHistoryViewResponse struct {
+	ViewResponse
+	Rows []AllHistoryViewResult `json:"rows,omitempty"`
+}
+
+type AllHistoryViewResult struct {
+	Id  string   `json:"id"`
+	Key []string `json:"key"`
+	Doc Page     `json:"doc"`
+}
+
+//Maps each page id to its path in an export.
+//Paths mirror the page hierarchy: a child of 'parent' is 'parent/child'
+func ExportPaths(pages []Page) map[string]string {
+	slugs := make(map[string]string)
+	for _, page := range pages {
+		slugs[page.Id] = exportName(&page)
+	}
+	paths := make(map[string]string)
+	for _, page := range pages {
+		parts := []string{}
+		for _, ancestor := range page.Lineage {
+			if slug, ok := slugs[ancestor]; ok && ancestor != page.Id {
+				parts = append(parts, slug)
+			}
+		}
+		paths[page.Id] = path.Join(append(parts, slugs[page.Id])...)
+	}
+	return paths
+}
+
+func exportName(page *Page) string {
+	if page.Slug != "" {
+		return page.Slug
+	}
+	return page.Id
+}
+
+//Renders a page as markdown with a front-matter header
+func PageMarkdown(page *Page, parentSlug string) string {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.WriteString("title: " + strconv.Quote(page.Title) + "\n")
+	buf.WriteString("slug: " + page.Slug + "\n")
+	buf.WriteString("owner: " + strconv.Quote(page.Owner) + "\n")
+	buf.WriteString("editor: " + strconv.Quote(page.LastEditor) + "\n")
+	buf.WriteString("timestamp: " + page.Timestamp.UTC().Format(time.RFC3339) + "\n")
+	if parentSlug != "" {
+		buf.WriteString("parent: " + parentSlug + "\n")
+	}
+	if len(page.Tags) > 0 {
+		tags := make([]string, len(page.Tags))
+		for i, tag := range page.Tags {
+			tags[i] = strconv.Quote(tag)
+		}
+		buf.WriteString("tags: [" + strings.Join(tags, ", ") + "]\n")
+	}
+	buf.WriteString("---\n\n")
+	buf.WriteString(page.Content.Raw)
+	return buf.String()
+}
+
+//Renders a page's formatted content as a standalone html document
+func PageHtml(page *Page) string {
+	title := html.EscapeString(page.Title)
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n" +
+		"<title>" + title + "</title>\n</head>\n<body>\n" +
+		"<h1>" + title + "</h1>\n" + page.Content.Formatted +
+		"\n</body>\n</html>\n"
+}
+
+//Writes a zip archive of the wiki's current pages (as markdown and html)
+//and file attachments to w, optionally including the page history.
+//Only the pages for which visible returns true are exported.
+func (wiki *Wiki) Export(w io.Writer, includeHistory bool,
+	visible func(*Page) bool) error {
+	rows, err := wiki.getCurrentPages()
+	if err != nil {
+		return err
+	}
+	pages := make([]Page, 0, len(rows))
+	for _, row := range rows {
+		page := row.Doc
+		page.Id = row.Id
+		if visible(&page) {
+			pages = append(pages, page)
+		}
+	}
+	paths := ExportPaths(pages)
+	slugs := make(map[string]string)
+	for _, page := range pages {
+		slugs[page.Id] = page.Slug
+	}
+	sort.Sort(byExportPath{pages, paths})
+	zw := zip.NewWriter(w)
+	for _, page := range pages {
+		name := "pages/" + paths[page.Id]
+		md := PageMarkdown(&page, slugs[page.Parent])
+		if err := writeZipEntry(zw, name+".md", page.Timestamp,
+			strings.NewReader(md)); err != nil {
+			return err
+		}
+		if err := writeZipEntry(zw, name+".html", page.Timestamp,
+			strings.NewReader(PageHtml(&page))); err != nil {
+			return err
+		}
+	}
+	if includeHistory {
+		if err := wiki.exportHistory(zw, paths, slugs); err != nil {
+			return err
+		}
+	}
+	if err := wiki.exportFiles(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+//Writes the historical revisions of every current page
+func (wiki *Wiki) exportHistory(zw *zip.Writer, paths map[string]string,
+	slugs map[string]string) error {
+	response := AllHistoryViewResponse{}
+	params := url.Values{}
+	params.Add("reduce", "false")
+	params.Add("include_docs", "true")
+	if err := wiki.db.GetView("wikit", "getHistory", &response, &params); err != nil {
+		return err
+	}
+	for _, row := range response.Rows {
+		owningPage := row.Doc.OwningPage
+		pagePath, ok := paths[owningPage]
+		if !ok || row.Id == owningPage {
+			//Skip the current revisions, and the history of deleted pages
+			continue
+		}
+		name := "history/" + pagePath + "/" +
+			row.Doc.Timestamp.UTC().Format("20060102T150405Z") + "-" + row.Id + ".md"
+		md := PageMarkdown(&row.Doc, slugs[row.Doc.Parent])
+		if err := writeZipEntry(zw, name, row.Doc.Timestamp,
+			strings.NewReader(md)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Writes the wiki's file attachments
+func (wiki *Wiki) exportFiles(zw *zip.Writer) error {
+	files, err := wiki.GetFileIndex("", 1, 0)
+	if err != nil {
+		return err
+	}
+	for _, file := range files.Rows {
+		attNames := []string{}
+		for attName := range file.Value.Attachments {
+			attNames = append(attNames, attName)
+		}
+		sort.Strings(attNames)
+		for _, attName := range attNames {
+			att := file.Value.Attachments[attName]
+			content, err := wiki.GetFileAttachment(file.Id, "", att.MimeType, attName)
+			if err != nil {
+				return err
+			}
+			err = writeZipEntry(zw, "files/"+file.Id+"/"+attName,
+				file.Value.Timestamp, content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeZipEntry(zw *zip.Writer, name string, modified time.Time,
+	content io.Reader) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.SetModTime(modified)
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+type byExportPath struct {
+	pages []Page
+	paths map[string]string
+}
+
+func (b byExportPath) Len() int      { return len(b.pages) }
+func (b byExportPath) Swap(i, j int) { b.pages[i], b.pages[j] = b.pages[j], b.pages[i] }
+func (b byExportPath) Less(i, j int) bool {
+	return b.paths[b.pages[i].Id] < b.paths[b.pages[j].Id]
+}
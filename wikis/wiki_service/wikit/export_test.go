@@ -0,0 +1,84 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportPaths(t *testing.T) {
+	pages := []Page{
+		{Id: "a", Slug: "guide", Lineage: []string{"a"}},
+		{Id: "b", Slug: "install", Parent: "a", Lineage: []string{"a", "b"}},
+		{Id: "c", Slug: "linux", Parent: "b", Lineage: []string{"a", "b", "c"}},
+		{Id: "d", Slug: "", Lineage: []string{"d"}},
+	}
+	paths := ExportPaths(pages)
+	expected := map[string]string{
+		"a": "guide",
+		"b": "guide/install",
+		"c": "guide/install/linux",
+		"d": "d",
+	}
+	for id, path := range expected {
+		if paths[id] != path {
+			t.Errorf("Expected path %v for %v, got %v", path, id, paths[id])
+		}
+	}
+}
+
+func TestPageMarkdown(t *testing.T) {
+	page := Page{
+		Title:      "Install \"Linux\"",
+		Slug:       "linux",
+		Owner:      "John.Smith",
+		LastEditor: "Jane.Doe",
+		Timestamp:  time.Date(2016, 3, 14, 9, 30, 0, 0, time.UTC),
+		Content:    PageContent{Raw: "# Linux\n", Formatted: "<h1>Linux</h1>"},
+		Tags:       []string{"howto"},
+	}
+	md := PageMarkdown(&page, "install")
+	expected := "---\ntitle: \"Install \\\"Linux\\\"\"\nslug: linux\n" +
+		"owner: \"John.Smith\"\neditor: \"Jane.Doe\"\n" +
+		"timestamp: 2016-03-14T09:30:00Z\nparent: install\n" +
+		"tags: [\"howto\"]\n---\n\n# Linux\n"
+	if md != expected {
+		t.Errorf("Unexpected markdown:\n%v", md)
+	}
+	doc := PageHtml(&page)
+	if !strings.Contains(doc, "<title>Install &#34;Linux&#34;</title>") ||
+		!strings.Contains(doc, "<h1>Linux</h1>") {
+		t.Errorf("Unexpected html:\n%v", doc)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	updated := time.Date(2016, 3, 14, 15, 9, 26, 0, time.UTC)
+	return &Feed{
+		Title:   "Guide - Recent Changes",
+		Link:    "http://localhost/app/wikis/guide",
+		Self:    "http://localhost/api/v1/wikis/1234/changes/atom",
+		Updated: updated,
+		Entries: []FeedEntry{
+			{
+				Id:      "urn:wikifeat:1234:abcd",
+				Title:   "Install & Run was edited by bob",
+				Link:    "http://localhost/app/wikis/guide/pages/install-run",
+				Author:  "bob",
+				Updated: updated,
+			},
+		},
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := testFeed().WriteAtom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	feed := struct {
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Entries []struct {
+			Id     string `xml:"id"`
+			Title  string `xml:"title"`
+			Author string `xml:"author>name"`
+			Link   struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `xmlns="http://www.w3.org/2005/Atom"`) {
+		t.Errorf("Missing Atom namespace: %v", buf.String())
+	}
+	if feed.Updated != "2016-03-14T15:09:26Z" || len(feed.Entries) != 1 {
+		t.Fatalf("Unexpected feed: %v", feed)
+	}
+	entry := feed.Entries[0]
+	if entry.Title != "Install & Run was edited by bob" || entry.Author != "bob" ||
+		entry.Link.Href != "http://localhost/app/wikis/guide/pages/install-run" {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+}
+
+func TestFeedRSS(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := testFeed().WriteRSS(&buf); err != nil {
+		t.Fatal(err)
+	}
+	feed := struct {
+		Version string `xml:"version,attr"`
+		Items   []struct {
+			Title   string `xml:"title"`
+			Guid    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Version != "2.0" || len(feed.Items) != 1 {
+		t.Fatalf("Unexpected feed: %v", feed)
+	}
+	item := feed.Items[0]
+	if item.Guid != "urn:wikifeat:1234:abcd" ||
+		item.PubDate != "Mon, 14 Mar 2016 15:09:26 +0000" {
+		t.Errorf("Unexpected item: %v", item)
+	}
+}
@@ -0,0 +1,319 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Page hierarchy management
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"log"
+	"net/url"
+	"sort"
+)
+
+//Outcome of an operation that touches a whole page subtree
+type SubtreeResult struct {
+	Updated []string         `json:"updated"`
+	Failed  []SubtreeFailure `json:"failed"`
+}
+
+type SubtreeFailure struct {
+	PageId string `json:"pageId"`
+	Reason string `json:"reason"`
+}
+
+type DescendantViewResponse struct {
+	ViewResponse
+	Rows []DescendantViewResult `json:"rows,omitempty"`
+}
+
+type DescendantViewResult struct {
+	Id  string        `json:"id"`
+	Doc DescendantDoc `json:"doc"`
+}
+
+type DescendantDoc struct {
+	Page
+	Rev string `json:"_rev"`
+}
+
+func (sr *SubtreeResult) addFailure(pageId string, err error) {
+	reason := err.Error()
+	if cErr, ok := err.(*Error); ok {
+		reason = cErr.Reason
+	}
+	sr.Failed = append(sr.Failed, SubtreeFailure{PageId: pageId, Reason: reason})
+}
+
+//Gets the current versions of every page beneath a page
+//Historical copies are excluded
+func (wiki *Wiki) GetDescendants(pageId string) ([]DescendantDoc, error) {
+	response := DescendantViewResponse{}
+	params := url.Values{}
+	params.Add("startkey", "["+quotifyString(pageId)+"]")
+	params.Add("endkey", "["+quotifyString(pageId)+",{}]")
+	params.Add("include_docs", "true")
+	err := wiki.db.GetView("wikit", "getDescendants", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	descendants := []DescendantDoc{}
+	for _, row := range response.Rows {
+		doc := row.Doc
+		if row.Id == pageId || doc.DocType != "page" || doc.OwningPage != row.Id {
+			continue
+		}
+		doc.Id = row.Id
+		descendants = append(descendants, doc)
+	}
+	return descendants, nil
+}
+
+//Moves a page beneath a new parent.  An empty parent makes it a top level page.
+//The lineage of every descendant is rewritten to match, and restrictions
+//inherited from the old ancestors are replaced by those of the new ones.
+//Returns the new revision of the page.  Descendants that couldn't be
+//updated are listed in the SubtreeResult.
+func (wiki *Wiki) MovePage(id string, rev string,
+	newParent string) (string, *SubtreeResult, error) {
+	page := Page{}
+	if _, err := wiki.ReadPage(id, &page); err != nil {
+		return "", nil, err
+	} else if page.OwningPage != id {
+		return "", nil, &Error{
+			StatusCode: 400,
+			Reason:     "Historical revisions can't be moved",
+		}
+	}
+	newLineage := []string{id}
+	if newParent != "" {
+		parentPage := Page{}
+		if _, err := wiki.ReadPage(newParent, &parentPage); err != nil {
+			return "", nil, err
+		}
+		if parentPage.OwningPage != newParent {
+			return "", nil, &Error{
+				StatusCode: 400,
+				Reason:     "Parent is not a current page",
+			}
+		}
+		//No cycles, please.
+		for _, ancestor := range append(parentPage.Lineage, newParent) {
+			if ancestor == id {
+				return "", nil, &Error{
+					StatusCode: 400,
+					Reason:     "A page can't be moved beneath itself",
+				}
+			}
+		}
+		newLineage = append(parentPage.Lineage, id)
+	}
+	page.Parent = newParent
+	page.Lineage = newLineage
+	//The page takes on the restrictions of its new ancestors
+	if !page.Restriction.Explicit() {
+		explicit, err := wiki.ancestorRestrictions(newLineage)
+		if err != nil {
+			return "", nil, err
+		}
+		page.Restriction = InheritRestriction(newLineage, explicit)
+	}
+	//This is a structural change, it doesn't get a history entry
+	nRev, err := wiki.db.Save(&page, id, rev)
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := wiki.rewriteSubtree(id, &page)
+	return nRev, result, err
+}
+
+//What to do with a page's descendants when it is deleted
+const (
+	//Children are moved up to the deleted page's parent
+	DeletePromote = "promote"
+	//The whole subtree is deleted
+	DeleteRecursive = "recursive"
+)
+
+//Outcome (or preview) of deleting a page
+type DeleteResult struct {
+	Mode    string           `json:"mode"`
+	DryRun  bool             `json:"dryRun"`
+	Deleted []AffectedPage   `json:"deleted"`
+	Moved   []AffectedPage   `json:"moved"`
+	Failed  []SubtreeFailure `json:"failed"`
+}
+
+type AffectedPage struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+}
+
+func affected(id string, page *Page) AffectedPage {
+	return AffectedPage{Id: id, Title: page.Title, Slug: page.Slug}
+}
+
+//Lists the pages that would be deleted or moved by deleting a page
+func (wiki *Wiki) PlanDelete(id string, mode string) (*DeleteResult, error) {
+	page := Page{}
+	if _, err := wiki.ReadPage(id, &page); err != nil {
+		return nil, err
+	}
+	descendants, err := wiki.GetDescendants(id)
+	if err != nil {
+		return nil, err
+	}
+	return planDelete(id, &page, mode, descendants)
+}
+
+func planDelete(id string, page *Page, mode string,
+	descendants []DescendantDoc) (*DeleteResult, error) {
+	result := &DeleteResult{
+		Mode:    mode,
+		Deleted: []AffectedPage{affected(id, page)},
+		Moved:   []AffectedPage{},
+		Failed:  []SubtreeFailure{},
+	}
+	switch mode {
+	case DeleteRecursive:
+		for i := range descendants {
+			result.Deleted = append(result.Deleted,
+				affected(descendants[i].Id, &descendants[i].Page))
+		}
+	case DeletePromote:
+		for i := range descendants {
+			if descendants[i].Parent == id {
+				result.Moved = append(result.Moved,
+					affected(descendants[i].Id, &descendants[i].Page))
+			}
+		}
+	default:
+		return nil, &Error{
+			StatusCode: 400,
+			Reason:     "Unknown delete mode: " + mode,
+		}
+	}
+	return result, nil
+}
+
+//Deletes a page, along with its descendants or promoting its children,
+//depending on the mode.  If any descendant can't be deleted or moved, the
+//page itself is left in place so nothing becomes unreachable.
+func (wiki *Wiki) DeletePageTree(id string, rev string,
+	mode string, editor string) (string, *DeleteResult, error) {
+	page := Page{}
+	curRev, err := wiki.ReadPage(id, &page)
+	if err != nil {
+		return "", nil, err
+	}
+	//Check the revision before touching any descendants
+	if curRev != rev {
+		return "", nil, &Error{
+			StatusCode: 409,
+			Reason:     "Document update conflict.",
+		}
+	}
+	descendants, err := wiki.GetDescendants(id)
+	if err != nil {
+		return "", nil, err
+	}
+	plan, err := planDelete(id, &page, mode, descendants)
+	if err != nil {
+		return "", nil, err
+	}
+	result := &DeleteResult{
+		Mode:    mode,
+		Deleted: []AffectedPage{},
+		Moved:   []AffectedPage{},
+		Failed:  []SubtreeFailure{},
+	}
+	revs := make(map[string]string)
+	for _, doc := range descendants {
+		revs[doc.Id] = doc.Rev
+	}
+	if mode == DeleteRecursive {
+		//Deepest pages first
+		sort.Stable(byDepth(descendants))
+		for i := range descendants {
+			doc := &descendants[i]
+			if _, err := wiki.DeletePage(doc.Id, doc.Rev); err != nil {
+				result.addFailure(doc.Id, err)
+			} else {
+				result.Deleted = append(result.Deleted, affected(doc.Id, &doc.Page))
+				wiki.recordDeletion(&doc.Page, doc.Id, editor)
+			}
+		}
+	} else {
+		for _, child := range plan.Moved {
+			_, sr, err := wiki.MovePage(child.Id, revs[child.Id], page.Parent)
+			if err != nil {
+				result.addFailure(child.Id, err)
+				continue
+			}
+			result.Moved = append(result.Moved, child)
+			result.Failed = append(result.Failed, sr.Failed...)
+		}
+	}
+	if len(result.Failed) > 0 {
+		result.Failed = append(result.Failed, SubtreeFailure{
+			PageId: id,
+			Reason: "Not deleted, some descendants could not be updated",
+		})
+		return "", result, nil
+	}
+	dRev, err := wiki.DeletePage(id, rev)
+	if err != nil {
+		return "", result, err
+	}
+	result.Deleted = append(result.Deleted, affected(id, &page))
+	wiki.recordDeletion(&page, id, editor)
+	return dRev, result, nil
+}
+
+//The page is gone either way, so a missing record is only logged
+func (wiki *Wiki) recordDeletion(page *Page, id string, editor string) {
+	if _, err := wiki.RecordDeletion(page, id, editor); err != nil {
+		log.Printf("Error recording deletion of page %v: %v", id, err)
+	}
+}
+
+func (result *DeleteResult) addFailure(pageId string, err error) {
+	sr := SubtreeResult{}
+	sr.addFailure(pageId, err)
+	result.Failed = append(result.Failed, sr.Failed...)
+}
+
+type byDepth []DescendantDoc
+
+func (d byDepth) Len() int           { return len(d) }
+func (d byDepth) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDepth) Less(i, j int) bool { return len(d[i].Lineage) > len(d[j].Lineage) }
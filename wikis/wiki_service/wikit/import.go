@@ -0,0 +1,338 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Wiki import
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//A markdown page read from an import archive
+type ImportPage struct {
+	Path    string   //Where the page sits in the hierarchy, e.g. guide/install
+	Source  string   //The page's file in the archive.  Empty for a directory placeholder
+	Parent  string   //Path of the parent page.  Empty for a top level page
+	Title   string   //From the front-matter, the first heading or the file name
+	Tags    []string //From the front-matter
+	Content string   //The markdown, without its front-matter
+}
+
+//The contents of an import archive
+type ImportArchive struct {
+	Pages    []ImportPage         //Parents come before their children
+	Files    map[string]*zip.File //Everything but the pages, by path
+	TooLarge []string             //Pages over MaxImportPageSize, which are left out
+}
+
+//Largest markdown file read from an import archive, in bytes
+const MaxImportPageSize = 4 << 20
+
+var markdownExtensions = map[string]bool{".md": true, ".markdown": true}
+var errTooLarge = errors.New("Page is too large")
+var headingRegexp = regexp.MustCompile(`^#{1,6}[ \t]+(.+?)[ \t#]*$`)
+
+//Reads the pages and files of a zip archive of markdown documents.
+//The directory structure becomes the page hierarchy: 'guide/install.md'
+//is a child of 'guide.md' (or of 'guide/index.md' or 'guide/README.md').
+//Directories without a page of their own get an empty placeholder page.
+func ReadImportArchive(zr *zip.Reader) (*ImportArchive, error) {
+	entries := []*zip.File{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || isHiddenPath(f.Name) {
+			continue
+		}
+		entries = append(entries, f)
+	}
+	root := commonRoot(entries)
+	archive := ImportArchive{Files: make(map[string]*zip.File)}
+	pages := make(map[string]*ImportPage)
+	for _, f := range entries {
+		name := strings.TrimPrefix(f.Name, root)
+		ext := strings.ToLower(path.Ext(name))
+		if !markdownExtensions[ext] {
+			archive.Files[name] = f
+			continue
+		}
+		pagePath := strings.TrimSuffix(name, path.Ext(name))
+		base := strings.ToLower(path.Base(pagePath))
+		if dir := path.Dir(pagePath); dir != "." && (base == "index" || base == "readme") {
+			pagePath = dir
+		}
+		if existing, ok := pages[pagePath]; ok && existing.Source != "" &&
+			path.Dir(existing.Source) != pagePath {
+			//'guide.md' wins over 'guide/index.md'
+			continue
+		}
+		text, err := readZipFile(f)
+		if err == errTooLarge {
+			archive.TooLarge = append(archive.TooLarge, name)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fields, content := ParseFrontMatter(text)
+		page := ImportPage{
+			Path:    pagePath,
+			Source:  name,
+			Title:   fields["title"],
+			Tags:    ParseFrontMatterList(fields["tags"]),
+			Content: content,
+		}
+		if page.Title == "" {
+			page.Title = firstHeading(content)
+		}
+		if page.Title == "" {
+			page.Title = titleFromPath(pagePath)
+		}
+		pages[pagePath] = &page
+	}
+	//Fill in the directories which have no page
+	for _, page := range pages {
+		for dir := path.Dir(page.Path); dir != "."; dir = path.Dir(dir) {
+			if _, ok := pages[dir]; !ok {
+				pages[dir] = &ImportPage{Path: dir, Title: titleFromPath(dir)}
+			}
+		}
+	}
+	for _, page := range pages {
+		if dir := path.Dir(page.Path); dir != "." {
+			page.Parent = dir
+		}
+		archive.Pages = append(archive.Pages, *page)
+	}
+	sort.Sort(byImportDepth(archive.Pages))
+	return &archive, nil
+}
+
+//Splits a '---' delimited front-matter block of 'key: value' lines
+//from the start of a markdown document.
+//Returns the fields and the rest of the document.
+func ParseFrontMatter(text string) (map[string]string, string) {
+	fields := make(map[string]string)
+	lines := SplitLines(strings.Replace(text, "\r\n", "\n", -1))
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return fields, text
+	}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "---" || line == "..." {
+			return fields, strings.TrimLeft(strings.Join(lines[i+1:], ""), "\n")
+		}
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:sep]))
+		fields[key] = unquote(strings.TrimSpace(line[sep+1:]))
+	}
+	//No closing line, so it wasn't front-matter after all
+	return make(map[string]string), text
+}
+
+//Parses a front-matter list, either '[a, b]' or 'a, b'
+func ParseFrontMatterList(value string) []string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var mdLinkRegexp = regexp.MustCompile(`(!?\[[^\]\n]*\]\()(<[^>\n]+>|[^)\s]+)((?:\s+"[^"\n]*")?\))`)
+var mdLinkDefRegexp = regexp.MustCompile(`(?m)^( {0,3}\[[^\]\n]+\]:[ \t]*)(\S+)`)
+var urlSchemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+//Rewrites the relative link and image targets of a markdown document.
+//resolve is given the target's path in the archive (relative to the
+//document at source, and without any #fragment) and returns the new target.
+//Targets resolve doesn't know are left alone.
+func RewriteImportLinks(mdText string, source string,
+	resolve func(target string) (string, bool)) string {
+	rewrite := func(target string) string {
+		bare := strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+		if bare == "" || urlSchemeRegexp.MatchString(bare) ||
+			strings.HasPrefix(bare, "/") || strings.HasPrefix(bare, "#") {
+			return target
+		}
+		fragment := ""
+		if i := strings.Index(bare, "#"); i >= 0 {
+			bare, fragment = bare[:i], bare[i:]
+		}
+		if i := strings.Index(bare, "?"); i >= 0 {
+			bare = bare[:i]
+		}
+		//A '+' in a path is just a '+'
+		bare = strings.Replace(bare, "+", "%2B", -1)
+		if unescaped, err := url.QueryUnescape(bare); err == nil {
+			bare = unescaped
+		}
+		targetPath := path.Join(path.Dir(source), bare)
+		if strings.HasPrefix(targetPath, "../") {
+			return target
+		}
+		if newTarget, ok := resolve(targetPath); ok {
+			return newTarget + fragment
+		}
+		return target
+	}
+	replaceText := func(text string) string {
+		text = mdLinkRegexp.ReplaceAllStringFunc(text, func(match string) string {
+			parts := mdLinkRegexp.FindStringSubmatch(match)
+			return parts[1] + rewrite(parts[2]) + parts[3]
+		})
+		return mdLinkDefRegexp.ReplaceAllStringFunc(text, func(match string) string {
+			parts := mdLinkDefRegexp.FindStringSubmatch(match)
+			return parts[1] + rewrite(parts[2])
+		})
+	}
+	return replaceOutsideCode(mdText, replaceText)
+}
+
+//Finds the page path of a link target in the archive
+//Accepts 'guide/install.md', 'guide/install' and 'guide/' style targets
+func (archive *ImportArchive) FindPage(target string) (*ImportPage, bool) {
+	target = strings.TrimSuffix(target, "/")
+	for i, page := range archive.Pages {
+		if page.Source == target || page.Path == target ||
+			(page.Source != "" && strings.TrimSuffix(page.Source,
+				path.Ext(page.Source)) == target) {
+			return &archive.Pages[i], true
+		}
+	}
+	return nil, false
+}
+
+func readZipFile(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	//The size in the zip header can't be trusted
+	content, err := ioutil.ReadAll(io.LimitReader(rc, MaxImportPageSize+1))
+	if err != nil {
+		return "", err
+	} else if len(content) > MaxImportPageSize {
+		return "", errTooLarge
+	}
+	return string(content), nil
+}
+
+//Files and directories starting with '.', and macOS resource forks
+func isHiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+//Finds the single top level directory containing everything, if any
+//(as in an archive of a git repository), including the trailing slash
+func commonRoot(entries []*zip.File) string {
+	root := ""
+	for _, f := range entries {
+		slash := strings.Index(f.Name, "/")
+		if slash < 0 {
+			return ""
+		}
+		if root == "" {
+			root = f.Name[:slash+1]
+		} else if root != f.Name[:slash+1] {
+			return ""
+		}
+	}
+	return root
+}
+
+func firstHeading(mdText string) string {
+	for _, line := range SplitLines(mdText) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if match := headingRegexp.FindStringSubmatch(line); match != nil {
+			return match[1]
+		}
+		return ""
+	}
+	return ""
+}
+
+//'getting-started' becomes 'Getting started'
+func titleFromPath(pagePath string) string {
+	title := strings.TrimSpace(strings.NewReplacer("-", " ", "_", " ").
+		Replace(path.Base(pagePath)))
+	if title == "" {
+		return pagePath
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 {
+		if value[0] == '"' && value[len(value)-1] == '"' {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+		} else if value[0] == '\'' && value[len(value)-1] == '\'' {
+			return strings.Replace(value[1:len(value)-1], "''", "'", -1)
+		}
+	}
+	return value
+}
+
+type byImportDepth []ImportPage
+
+func (d byImportDepth) Len() int      { return len(d) }
+func (d byImportDepth) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byImportDepth) Less(i, j int) bool {
+	di, dj := strings.Count(d[i].Path, "/"), strings.Count(d[j].Path, "/")
+	if di != dj {
+		return di < dj
+	}
+	return d[i].Path < d[j].Path
+}
@@ -0,0 +1,147 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	"archive/zip"
+	"bytes"
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"strings"
+	"testing"
+)
+
+func makeZip(t *testing.T, files map[string]string) *zip.Reader {
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestReadImportArchive(t *testing.T) {
+	zr := makeZip(t, map[string]string{
+		"docs-main/README.md":               "# Documentation\n",
+		"docs-main/guide/index.md":          "---\ntitle: \"The Guide\"\ntags: [howto, 'intro']\n---\n\nRead me\n",
+		"docs-main/guide/install/linux.md":  "Linux\n",
+		"docs-main/guide/images/shot.png":   "png",
+		"docs-main/.github/CONTRIBUTING.md": "hidden\n",
+		"docs-main/huge.md":                 strings.Repeat("a", MaxImportPageSize+1),
+	})
+	archive, err := ReadImportArchive(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ImportPage{
+		{Path: "README", Source: "README.md", Title: "Documentation"},
+		{Path: "guide", Source: "guide/index.md", Title: "The Guide"},
+		{Path: "guide/install", Parent: "guide", Title: "Install"},
+		{Path: "guide/install/linux", Source: "guide/install/linux.md",
+			Parent: "guide/install", Title: "Linux"},
+	}
+	if len(archive.Pages) != len(expected) {
+		t.Fatalf("Expected %v pages, got %v", len(expected), archive.Pages)
+	}
+	for i, page := range archive.Pages {
+		exp := expected[i]
+		if page.Path != exp.Path || page.Source != exp.Source ||
+			page.Parent != exp.Parent || page.Title != exp.Title {
+			t.Errorf("Expected %v, got %v", exp, page)
+		}
+	}
+	guide := archive.Pages[1]
+	if guide.Content != "Read me\n" {
+		t.Errorf("Front-matter not removed: %q", guide.Content)
+	}
+	if len(guide.Tags) != 2 || guide.Tags[0] != "howto" || guide.Tags[1] != "intro" {
+		t.Errorf("Unexpected tags: %v", guide.Tags)
+	}
+	if _, ok := archive.Files["guide/images/shot.png"]; !ok || len(archive.Files) != 1 {
+		t.Errorf("Unexpected files: %v", archive.Files)
+	}
+	if page, ok := archive.FindPage("guide/install/linux.md"); !ok || page.Title != "Linux" {
+		t.Errorf("Page not found by source")
+	}
+	if len(archive.TooLarge) != 1 || archive.TooLarge[0] != "huge.md" {
+		t.Errorf("Oversized page should be left out: %v", archive.TooLarge)
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	fields, body := ParseFrontMatter("---\nno closing line\n")
+	if len(fields) != 0 || body != "---\nno closing line\n" {
+		t.Errorf("Unclosed front-matter should be left alone: %v, %q", fields, body)
+	}
+	fields, body = ParseFrontMatter("---\r\nTitle: It's: here\r\n---\r\nText\r\n")
+	if fields["title"] != "It's: here" || body != "Text\n" {
+		t.Errorf("Unexpected front-matter: %v, %q", fields, body)
+	}
+}
+
+func TestRewriteImportLinks(t *testing.T) {
+	resolve := func(target string) (string, bool) {
+		switch target {
+		case "guide/install.md":
+			return "/app/wikis/docs/pages/install", true
+		case "guide/images/a b.png":
+			return "/files/1", true
+		case "guide/c++.md":
+			return "/app/wikis/docs/pages/c", true
+		}
+		return "", false
+	}
+	md := "See [install](install.md#linux), ![shot](images/a%20b.png \"Shot\")\n" +
+		"[ext](http://example.com) [up](../../outside.md) [miss](missing.md)\n" +
+		"`[code](install.md)`\n" +
+		"```\n[fenced](install.md)\n```\n" +
+		"[ref]: ./install.md\n" +
+		"[cpp](c++.md)\n"
+	expected := "See [install](/app/wikis/docs/pages/install#linux), ![shot](/files/1 \"Shot\")\n" +
+		"[ext](http://example.com) [up](../../outside.md) [miss](missing.md)\n" +
+		"`[code](install.md)`\n" +
+		"```\n[fenced](install.md)\n```\n" +
+		"[ref]: /app/wikis/docs/pages/install\n" +
+		"[cpp](/app/wikis/docs/pages/c)\n"
+	if result := RewriteImportLinks(md, "guide/start.md", resolve); result != expected {
+		t.Errorf("Unexpected result:\n%v", result)
+	}
+}
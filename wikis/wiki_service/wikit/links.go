@@ -0,0 +1,151 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// [[Wiki link]] parsing
+
+import (
+	"regexp"
+	"strings"
+)
+
+//A [[wiki link]] as written in page markdown:
+//[[Page Title]], [[Page Title|label]] or [[wiki-slug:Page Title|label]]
+type WikiLinkRef struct {
+	WikiSlug string //Empty for a link within the same wiki
+	Title    string
+	Label    string
+}
+
+//A resolved wiki link target, stored on the page
+type PageLink struct {
+	WikiId string `json:"wikiId"`
+	PageId string `json:"pageId"` //Empty if the target page doesn't exist
+	Slug   string `json:"slug"`
+	Title  string `json:"title"`
+}
+
+var wikiLinkRegexp = regexp.MustCompile(`\[\[([^\[\]\n|]+)(?:\|([^\[\]\n]+))?\]\]`)
+var wikiSlugRegexp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+//Parses the inside of a [[wiki link]]
+func ParseWikiLink(title string, label string) WikiLinkRef {
+	ref := WikiLinkRef{}
+	title = strings.TrimSpace(title)
+	if i := strings.Index(title, ":"); i > 0 {
+		//Only treat the prefix as a wiki if it looks like a slug,
+		//so titles like "FAQ: Setup" still work
+		if prefix := strings.TrimSpace(title[:i]); wikiSlugRegexp.MatchString(prefix) {
+			ref.WikiSlug = prefix
+			title = strings.TrimSpace(title[i+1:])
+		}
+	}
+	ref.Title = title
+	ref.Label = strings.TrimSpace(label)
+	if ref.Label == "" {
+		ref.Label = ref.Title
+	}
+	return ref
+}
+
+//Lists the wiki links in a markdown document
+func FindWikiLinks(mdText string) []WikiLinkRef {
+	refs := []WikiLinkRef{}
+	ReplaceWikiLinks(mdText, func(ref WikiLinkRef) string {
+		refs = append(refs, ref)
+		return ""
+	})
+	return refs
+}
+
+//Replaces each wiki link in a markdown document with the result of replace.
+//Links inside code blocks and code spans are left alone.
+func ReplaceWikiLinks(mdText string, replace func(WikiLinkRef) string) string {
+	replaceText := func(text string) string {
+		return wikiLinkRegexp.ReplaceAllStringFunc(text, func(match string) string {
+			parts := wikiLinkRegexp.FindStringSubmatch(match)
+			ref := ParseWikiLink(parts[1], parts[2])
+			if ref.Title == "" {
+				return match
+			}
+			return replace(ref)
+		})
+	}
+	return replaceOutsideCode(mdText, replaceText)
+}
+
+//Applies replaceText to the parts of the markdown which aren't
+//fenced code blocks or `code spans`
+func replaceOutsideCode(mdText string, replaceText func(string) string) string {
+	lines := SplitLines(mdText)
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		lines[i] = replaceOutsideCodeSpans(line, replaceText)
+	}
+	return strings.Join(lines, "")
+}
+
+//Applies replaceText to the parts of a line which aren't `code spans`
+func replaceOutsideCodeSpans(line string, replaceText func(string) string) string {
+	var out []string
+	rest := line
+	for {
+		start := strings.Index(rest, "`")
+		if start < 0 {
+			break
+		}
+		n := 0
+		for start+n < len(rest) && rest[start+n] == '`' {
+			n++
+		}
+		ticks := rest[start : start+n]
+		end := strings.Index(rest[start+n:], ticks)
+		if end < 0 {
+			break
+		}
+		end += start + n + n
+		out = append(out, replaceText(rest[:start]), rest[start:end])
+		rest = rest[end:]
+	}
+	out = append(out, replaceText(rest))
+	return strings.Join(out, "")
+}
@@ -0,0 +1,67 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+)
+
+func TestFindWikiLinks(t *testing.T) {
+	md := "See [[Page One]] and [[other-wiki:FAQ: Setup|the FAQ]].\n" +
+		"Not `[[Code Span]]` though.\n" +
+		"```\n[[Fenced]]\n```\n" +
+		"[[FAQ: Setup]]\n"
+	refs := FindWikiLinks(md)
+	expected := []WikiLinkRef{
+		{Title: "Page One", Label: "Page One"},
+		{WikiSlug: "other-wiki", Title: "FAQ: Setup", Label: "the FAQ"},
+		{Title: "FAQ: Setup", Label: "FAQ: Setup"},
+	}
+	if len(refs) != len(expected) {
+		t.Fatalf("Expected %v links, got %v", len(expected), refs)
+	}
+	for i, ref := range refs {
+		if ref != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], ref)
+		}
+	}
+}
+
+func TestReplaceWikiLinks(t *testing.T) {
+	md := "A [[Page|label]] and `[[Code]]`\n"
+	out := ReplaceWikiLinks(md, func(ref WikiLinkRef) string {
+		return "<" + ref.Title + ">"
+	})
+	if out != "A <Page> and `[[Code]]`\n" {
+		t.Errorf("Unexpected replacement: %v", out)
+	}
+}
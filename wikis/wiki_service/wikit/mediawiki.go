@@ -0,0 +1,161 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// MediaWiki XML dumps
+
+import (
+	"encoding/xml"
+	. "github.com/rhinoman/couchdb-go"
+	"github.com/rhinoman/go-slugification"
+	"io"
+	"sort"
+	"time"
+)
+
+//A page from a MediaWiki XML export
+type MediaWikiPage struct {
+	Title     string              `xml:"title"`
+	Namespace int                 `xml:"ns"`
+	Revisions []MediaWikiRevision `xml:"revision"`
+}
+
+type MediaWikiRevision struct {
+	Id          string    `xml:"id"`
+	Timestamp   time.Time `xml:"timestamp"`
+	Contributor struct {
+		Username string `xml:"username"`
+		Ip       string `xml:"ip"`
+	} `xml:"contributor"`
+	Comment string `xml:"comment"`
+	Text    string `xml:"text"`
+}
+
+//The user name (or address) of the revision's editor
+func (rev *MediaWikiRevision) Editor() string {
+	if rev.Contributor.Username != "" {
+		return rev.Contributor.Username
+	} else if rev.Contributor.Ip != "" {
+		return rev.Contributor.Ip
+	}
+	return "unknown"
+}
+
+//Reads a MediaWiki XML export, calling handle for each page in turn,
+//with its revisions sorted oldest first
+func ReadMediaWikiDump(r io.Reader, handle func(*MediaWikiPage) error) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "page" {
+			continue
+		}
+		page := MediaWikiPage{}
+		if err := decoder.DecodeElement(&page, &start); err != nil {
+			return err
+		}
+		sort.Stable(byRevisionTime(page.Revisions))
+		if err := handle(&page); err != nil {
+			return err
+		}
+	}
+}
+
+//Creates a page from a list of revisions, oldest first, keeping each
+//revision's editor and timestamp.  The last revision becomes the
+//current page, the others its history.  If any revision can't be
+//saved, nothing of the page is kept.
+func (wiki *Wiki) ImportRevisions(id string, revisions []Page) (string, error) {
+	if len(revisions) == 0 {
+		return "", &Error{StatusCode: 400, Reason: "No revisions"}
+	}
+	current := revisions[len(revisions)-1]
+	owner := revisions[0].LastEditor
+	prepare := func(page *Page) {
+		page.DocType = "page"
+		page.Owner = owner
+		page.OwningPage = id
+		page.Parent = ""
+		page.Lineage = []string{id}
+		page.Tags = NormalizeTags(page.Tags)
+	}
+	prepare(&current)
+	current.Change = ChangeEdited
+	if len(revisions) == 1 {
+		current.Change = ChangeCreated
+	}
+	current.Slug = slugification.Slugify(current.Title)
+	if err := current.Validate(); err != nil {
+		return "", err
+	}
+	rev, err := wiki.db.Save(&current, id, "")
+	if err != nil {
+		return "", err
+	}
+	if err := wiki.CheckForDuplicateSlug(current.Slug); err != nil {
+		wiki.db.Delete(id, rev)
+		return "", err
+	}
+	copyRevs := make(map[string]string)
+	for i, revision := range revisions[:len(revisions)-1] {
+		prepare(&revision)
+		revision.Change = ChangeEdited
+		if i == 0 {
+			revision.Change = ChangeCreated
+		}
+		//Historical copies have no slug
+		revision.Slug = ""
+		copyId := getUuid()
+		copyRev, err := wiki.db.Save(&revision, copyId, "")
+		if err != nil {
+			//Don't leave a page with part of its history behind
+			for docId, docRev := range copyRevs {
+				wiki.db.Delete(docId, docRev)
+			}
+			wiki.db.Delete(id, rev)
+			return "", err
+		}
+		copyRevs[copyId] = copyRev
+	}
+	return rev, nil
+}
+
+type byRevisionTime []MediaWikiRevision
+
+func (r byRevisionTime) Len() int           { return len(r) }
+func (r byRevisionTime) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byRevisionTime) Less(i, j int) bool { return r[i].Timestamp.Before(r[j].Timestamp) }
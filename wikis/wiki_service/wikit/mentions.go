@@ -0,0 +1,116 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// @mentions of users in rendered page and comment html
+
+import (
+	"regexp"
+	"strings"
+)
+
+//A mention is an @ followed by a user name, not part of an email address
+var mentionRegexp = regexp.MustCompile(`(^|[^\w@.\-/])@(\w(?:[\w.\-]*\w)?)`)
+var tagNameRegexp = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9]*)`)
+
+//Mentions inside these elements are left alone
+var mentionFreeTags = map[string]bool{"a": true, "code": true, "pre": true}
+
+//Finds the user names mentioned in rendered html, in order of first
+//mention.  Mentions in links and code don't count.
+func FindMentions(htmlText string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	eachMentionText(htmlText, func(text string) string {
+		for _, match := range mentionRegexp.FindAllStringSubmatch(text, -1) {
+			if !seen[match[2]] {
+				seen[match[2]] = true
+				names = append(names, match[2])
+			}
+		}
+		return text
+	})
+	return names
+}
+
+//Links the mentions of the given users to their profiles
+func LinkMentions(htmlText string, users []string) string {
+	if len(users) == 0 {
+		return htmlText
+	}
+	linked := make(map[string]bool)
+	for _, user := range users {
+		linked[user] = true
+	}
+	return eachMentionText(htmlText, func(text string) string {
+		return mentionRegexp.ReplaceAllStringFunc(text, func(mention string) string {
+			match := mentionRegexp.FindStringSubmatch(mention)
+			if !linked[match[2]] {
+				return mention
+			}
+			return match[1] + `<a href="/app/users/` + match[2] +
+				`" data-mention="` + match[2] + `">@` + match[2] + `</a>`
+		})
+	})
+}
+
+//Rewrites the text of the html that isn't inside a link or code
+func eachMentionText(htmlText string, rewrite func(string) string) string {
+	var out []string
+	depth := 0
+	pos := 0
+	for _, loc := range htmlTagRegexp.FindAllStringIndex(htmlText, -1) {
+		if text := htmlText[pos:loc[0]]; depth == 0 {
+			out = append(out, rewrite(text))
+		} else {
+			out = append(out, text)
+		}
+		tag := htmlText[loc[0]:loc[1]]
+		if name := tagNameRegexp.FindStringSubmatch(tag); name != nil &&
+			mentionFreeTags[strings.ToLower(name[1])] {
+			if strings.HasPrefix(tag, "</") {
+				if depth > 0 {
+					depth--
+				}
+			} else if !strings.HasSuffix(tag, "/>") {
+				depth++
+			}
+		}
+		out = append(out, tag)
+		pos = loc[1]
+	}
+	if depth == 0 {
+		out = append(out, rewrite(htmlText[pos:]))
+	} else {
+		out = append(out, htmlText[pos:])
+	}
+	return strings.Join(out, "")
+}
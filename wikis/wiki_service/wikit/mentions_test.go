@@ -0,0 +1,65 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"reflect"
+	"testing"
+)
+
+var mentionHtml = "<p>Thanks @John.Smith and @jane_doe, also @John.Smith.</p>\n" +
+	"<p>Mail bob@example.com or see <a href=\"/x\">@linked</a></p>\n" +
+	"<pre><code>@coder\n</code></pre>\n<p><code>@inline</code> @nobody</p>\n"
+
+func TestFindMentions(t *testing.T) {
+	mentions := FindMentions(mentionHtml)
+	expected := []string{"John.Smith", "jane_doe", "nobody"}
+	if !reflect.DeepEqual(mentions, expected) {
+		t.Errorf("Expected %v, got %v", expected, mentions)
+	}
+}
+
+func TestLinkMentions(t *testing.T) {
+	linked := LinkMentions(mentionHtml, []string{"John.Smith", "jane_doe"})
+	expected := "<p>Thanks <a href=\"/app/users/John.Smith\" data-mention=\"John.Smith\">@John.Smith</a>" +
+		" and <a href=\"/app/users/jane_doe\" data-mention=\"jane_doe\">@jane_doe</a>, also " +
+		"<a href=\"/app/users/John.Smith\" data-mention=\"John.Smith\">@John.Smith</a>.</p>\n" +
+		"<p>Mail bob@example.com or see <a href=\"/x\">@linked</a></p>\n" +
+		"<pre><code>@coder\n</code></pre>\n<p><code>@inline</code> @nobody</p>\n"
+	if linked != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, linked)
+	}
+	//Linked mentions are found again, but not linked twice
+	if LinkMentions(linked, []string{"John.Smith"}) != linked {
+		t.Error("Mentions should only be linked once")
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Three-way merging of page content
+
+import (
+	"strings"
+)
+
+//A region changed differently by both sides of a merge
+type MergeConflict struct {
+	Line   int    `json:"line"` //Where the region starts in the base text, from 1
+	Base   string `json:"base"`
+	Mine   string `json:"mine"`
+	Theirs string `json:"theirs"`
+}
+
+type MergeResult struct {
+	//The merged text.  Conflicting regions are wrapped in conflict markers.
+	Merged    string          `json:"merged"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
+
+func (mr *MergeResult) Clean() bool {
+	return len(mr.Conflicts) == 0
+}
+
+//A run of base lines [start, end) replaced by lines
+type mergeHunk struct {
+	start int
+	end   int
+	lines []string
+}
+
+//Merges two texts derived from a common base, line by line.
+//Changes made by only one side are taken; regions changed by both sides
+//are conflicts, unless both made the same change.
+func Merge3(base string, mine string, theirs string) *MergeResult {
+	baseLines := SplitLines(base)
+	mineHunks := diffHunks(baseLines, SplitLines(mine))
+	theirHunks := diffHunks(baseLines, SplitLines(theirs))
+	result := &MergeResult{Conflicts: []MergeConflict{}}
+	var out []string
+	pos := 0
+	i, j := 0, 0
+	for i < len(mineHunks) || j < len(theirHunks) {
+		//Gather overlapping (or touching) hunks from both sides
+		var gMine, gTheirs []mergeHunk
+		if j >= len(theirHunks) ||
+			(i < len(mineHunks) && mineHunks[i].start <= theirHunks[j].start) {
+			gMine = append(gMine, mineHunks[i])
+			i++
+		} else {
+			gTheirs = append(gTheirs, theirHunks[j])
+			j++
+		}
+		start := groupStart(gMine, gTheirs)
+		end := groupEnd(gMine, gTheirs)
+		for {
+			if i < len(mineHunks) && mineHunks[i].start <= end {
+				gMine = append(gMine, mineHunks[i])
+				i++
+			} else if j < len(theirHunks) && theirHunks[j].start <= end {
+				gTheirs = append(gTheirs, theirHunks[j])
+				j++
+			} else {
+				break
+			}
+			if e := groupEnd(gMine, gTheirs); e > end {
+				end = e
+			}
+		}
+		out = append(out, baseLines[pos:start]...)
+		pos = end
+		mineText := applyHunks(baseLines, start, end, gMine)
+		theirText := applyHunks(baseLines, start, end, gTheirs)
+		switch {
+		case len(gTheirs) == 0 || mineText == theirText:
+			out = append(out, mineText)
+		case len(gMine) == 0:
+			out = append(out, theirText)
+		default:
+			result.Conflicts = append(result.Conflicts, MergeConflict{
+				Line:   start + 1,
+				Base:   strings.Join(baseLines[start:end], ""),
+				Mine:   mineText,
+				Theirs: theirText,
+			})
+			out = append(out, "<<<<<<< mine\n", withNewline(mineText),
+				"=======\n", withNewline(theirText), ">>>>>>> theirs\n")
+		}
+	}
+	out = append(out, baseLines[pos:]...)
+	result.Merged = strings.Join(out, "")
+	return result
+}
+
+//Lists the regions of base replaced in other
+func diffHunks(base []string, other []string) []mergeHunk {
+	var hunks []mergeHunk
+	var cur *mergeHunk
+	pos := 0
+	for _, edit := range diffTokens(base, other) {
+		if edit.op == DiffEqual {
+			if cur != nil {
+				hunks = append(hunks, *cur)
+				cur = nil
+			}
+			pos++
+			continue
+		}
+		if cur == nil {
+			cur = &mergeHunk{start: pos, end: pos}
+		}
+		if edit.op == DiffDelete {
+			pos++
+			cur.end = pos
+		} else {
+			cur.lines = append(cur.lines, edit.token)
+		}
+	}
+	if cur != nil {
+		hunks = append(hunks, *cur)
+	}
+	return hunks
+}
+
+func groupStart(a []mergeHunk, b []mergeHunk) int {
+	if len(a) == 0 {
+		return b[0].start
+	} else if len(b) == 0 || a[0].start < b[0].start {
+		return a[0].start
+	}
+	return b[0].start
+}
+
+func groupEnd(a []mergeHunk, b []mergeHunk) int {
+	end := 0
+	for _, hunks := range [][]mergeHunk{a, b} {
+		if len(hunks) > 0 && hunks[len(hunks)-1].end > end {
+			end = hunks[len(hunks)-1].end
+		}
+	}
+	return end
+}
+
+//Applies one side's hunks to base lines [start, end)
+func applyHunks(base []string, start int, end int, hunks []mergeHunk) string {
+	var out []string
+	pos := start
+	for _, hunk := range hunks {
+		out = append(out, base[pos:hunk.start]...)
+		out = append(out, hunk.lines...)
+		pos = hunk.end
+	}
+	out = append(out, base[pos:end]...)
+	return strings.Join(out, "")
+}
+
+func withNewline(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		return text + "\n"
+	}
+	return text
+}
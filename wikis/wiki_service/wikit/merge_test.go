@@ -0,0 +1,73 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+)
+
+func TestMerge3Clean(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\n"
+	mine := "one\n2\nthree\nfour\nfive\n"
+	theirs := "one\ntwo\nthree\nfour\nfive\nsix\n"
+	result := Merge3(base, mine, theirs)
+	if !result.Clean() {
+		t.Errorf("Merge should be clean: %v", result.Conflicts)
+	}
+	if result.Merged != "one\n2\nthree\nfour\nfive\nsix\n" {
+		t.Errorf("Unexpected merge: %q", result.Merged)
+	}
+	//Both sides making the same change is not a conflict
+	result = Merge3(base, mine, mine)
+	if !result.Clean() || result.Merged != mine {
+		t.Errorf("Identical changes should merge: %q", result.Merged)
+	}
+}
+
+func TestMerge3Conflict(t *testing.T) {
+	base := "one\ntwo\nthree\n"
+	mine := "one\nmine\nthree\n"
+	theirs := "one\ntheirs\nthree\n"
+	result := Merge3(base, mine, theirs)
+	if len(result.Conflicts) != 1 {
+		t.Fatalf("Expected one conflict, got %v", result.Conflicts)
+	}
+	conflict := result.Conflicts[0]
+	if conflict.Line != 2 || conflict.Base != "two\n" ||
+		conflict.Mine != "mine\n" || conflict.Theirs != "theirs\n" {
+		t.Errorf("Unexpected conflict: %+v", conflict)
+	}
+	expected := "one\n<<<<<<< mine\nmine\n=======\ntheirs\n>>>>>>> theirs\nthree\n"
+	if result.Merged != expected {
+		t.Errorf("Unexpected merge: %q", result.Merged)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Heading anchors and page outlines
+
+import (
+	"github.com/rhinoman/go-slugification"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type OutlineEntry struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+	line   int    //Where the heading starts in the markdown, if known
+}
+
+//Headings may carry the source position of their markdown
+var plainHeadingRegexp = regexp.MustCompile(`(?s)<h([1-6])( data-sourcepos="[^"]*")?>(.*?)</h[1-6]>`)
+var anchoredHeadingRegexp = regexp.MustCompile(`(?s)<h([1-6]) id="([^"]*)"(?: data-sourcepos="(\d+):[^"]*")?>(.*?)</h[1-6]>`)
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+var dashesRegexp = regexp.MustCompile(`-{2,}`)
+
+//Starts every heading anchor
+const AnchorPrefix = "h-"
+
+//Gives the headings in rendered html ids made from their text, so
+//sections can be linked to.  Repeated headings get numbered ids
+//("h-setup", "h-setup-1"), so the same document always gets the same ids.
+func AnchorHeadings(htmlText string) string {
+	used := make(map[string]bool)
+	return plainHeadingRegexp.ReplaceAllStringFunc(htmlText, func(heading string) string {
+		match := plainHeadingRegexp.FindStringSubmatch(heading)
+		anchor := headingAnchor(headingText(match[3]), used)
+		return "<h" + match[1] + " id=\"" + anchor + "\"" + match[2] + ">" +
+			match[3] + "</h" + match[1] + ">"
+	})
+}
+
+//Makes an anchor from a heading's text, numbered if it's already used.
+//Anchors are prefixed, so a heading can't clobber the app's own
+//element ids or the globals browsers make for them.
+func headingAnchor(text string, used map[string]bool) string {
+	anchor := strings.Trim(dashesRegexp.ReplaceAllString(
+		slugification.Slugify(text), "-"), "-")
+	if anchor == "" {
+		anchor = "section"
+	}
+	anchor = AnchorPrefix + anchor
+	unique := anchor
+	for i := 1; used[unique]; i++ {
+		unique = anchor + "-" + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+//Lists the anchored headings in rendered html
+func ReadOutline(htmlText string) []OutlineEntry {
+	outline := []OutlineEntry{}
+	for _, match := range anchoredHeadingRegexp.FindAllStringSubmatch(htmlText, -1) {
+		level, _ := strconv.Atoi(match[1])
+		line, _ := strconv.Atoi(match[3])
+		outline = append(outline, OutlineEntry{
+			Level:  level,
+			Text:   headingText(match[4]),
+			Anchor: html.UnescapeString(match[2]),
+			line:   line,
+		})
+	}
+	return outline
+}
+
+//The plain text of a heading's html
+func headingText(headingHtml string) string {
+	text := html.UnescapeString(htmlTagRegexp.ReplaceAllString(headingHtml, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
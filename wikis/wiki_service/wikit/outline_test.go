@@ -0,0 +1,75 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+)
+
+func TestAnchorHeadings(t *testing.T) {
+	htmlText := "<h1>Getting Started</h1>\n<p>Intro</p>\n" +
+		"<h2>Setup &amp; <em>Install</em></h2>\n<h2>Setup &amp; Install</h2>\n" +
+		"<h3>***</h3>\n<h2 id=\"custom\">Custom</h2>\n"
+	anchored := AnchorHeadings(htmlText)
+	expected := "<h1 id=\"h-getting-started\">Getting Started</h1>\n<p>Intro</p>\n" +
+		"<h2 id=\"h-setup-install\">Setup &amp; <em>Install</em></h2>\n" +
+		"<h2 id=\"h-setup-install-1\">Setup &amp; Install</h2>\n" +
+		"<h3 id=\"h-section\">***</h3>\n<h2 id=\"custom\">Custom</h2>\n"
+	if anchored != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, anchored)
+	}
+	if AnchorHeadings(htmlText) != anchored {
+		t.Error("Anchors should be stable")
+	}
+	//Letters of other scripts are kept
+	cjk := AnchorHeadings("<h2>日本語 ガイド</h2>")
+	if cjk != "<h2 id=\"h-日本語-ガイド\">日本語 ガイド</h2>" {
+		t.Errorf("Wrong CJK anchor: %v", cjk)
+	}
+}
+
+func TestReadOutline(t *testing.T) {
+	htmlText := AnchorHeadings("<h1>Guide</h1><p>Text</p><h2>Setup &amp; <em>Install</em></h2>")
+	outline := ReadOutline(htmlText)
+	expected := []OutlineEntry{
+		{Level: 1, Text: "Guide", Anchor: "h-guide"},
+		{Level: 2, Text: "Setup & Install", Anchor: "h-setup-install"},
+	}
+	if len(outline) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, outline)
+	}
+	for i := range expected {
+		if outline[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], outline[i])
+		}
+	}
+}
@@ -44,19 +44,29 @@ type PageContent struct {
 }
 
 type Page struct {
-	Id              string      `json:"id,omitempty"`
-	Slug            string      `json:"slug"`
-	DocType         string      `json:"type"`
-	Title           string      `json:"title"`
-	Owner           string      `json:"owner"`  //a user name
-	LastEditor      string      `json:"editor"` //a user name
-	Timestamp       time.Time   `json:"timestamp"`
-	Content         PageContent `json:"content"`
-	Parent          string      `json:"parent"`                    //For page hierarchy: a document id
-	Lineage         []string    `json:"lineage"`                   //Parental hierarchy of this page
-	OwningPage      string      `json:"owningPage"`                //For page history: a document id
-	DisableComments bool        `json:"commentsDisabled"`          //disallow comments for this page
-	Attachments     []string    `json:"fileAttachments,omitempty"` //A list of file ids
+	Id              string         `json:"id,omitempty"`
+	Slug            string         `json:"slug"`
+	DocType         string         `json:"type"`
+	Title           string         `json:"title"`
+	Owner           string         `json:"owner"`  //a user name
+	LastEditor      string         `json:"editor"` //a user name
+	Timestamp       time.Time      `json:"timestamp"`
+	Content         PageContent    `json:"content"`
+	Parent          string         `json:"parent"`                    //For page hierarchy: a document id
+	Lineage         []string       `json:"lineage"`                   //Parental hierarchy of this page
+	OwningPage      string         `json:"owningPage"`                //For page history: a document id
+	PageRev         string         `json:"pageRev,omitempty"`         //For page history: the page revision this copy was taken from
+	DisableComments bool           `json:"commentsDisabled"`          //disallow comments for this page
+	Attachments     []string       `json:"fileAttachments,omitempty"` //A list of file ids
+	RevertedFrom    string         `json:"revertedFrom,omitempty"`    //History document this revision was reverted to
+	Change          string         `json:"change,omitempty"`          //How this revision came about: created or edited
+	Links           []PageLink     `json:"links"`                     //Targets of the page's [[wiki links]]
+	Tags            []string       `json:"tags"`                      //Labels for classifying pages
+	Restriction     *Restriction   `json:"restriction,omitempty"`     //Limits who may see and edit the page
+	Outline         []OutlineEntry `json:"outline,omitempty"`         //The page's headings, for a table of contents
+	Mentions        []string       `json:"mentions,omitempty"`        //Users @mentioned in the content
+	PreviousSlugs   []string       `json:"previousSlugs,omitempty"`   //Slugs the page had before it was renamed
+	RenamedAt       *time.Time     `json:"renamedAt,omitempty"`       //When the page's slug last changed
 }
 
 type File struct {
@@ -78,10 +88,12 @@ type Attachment struct {
 }
 
 type HistoryEntry struct {
-	Editor      string `json:"editor"`
-	ContentSize int    `json:"contentSize"`
-	DocumentId  string `json:"documentId"`
-	DocumentRev string `json:"documentRev"`
+	Editor       string `json:"editor"`
+	ContentSize  int    `json:"contentSize"`
+	DocumentId   string `json:"documentId"`
+	DocumentRev  string `json:"documentRev"`
+	RevertedFrom string `json:"revertedFrom,omitempty"`
+	PageRev      string `json:"pageRev,omitempty"`
 }
 
 type ViewResponse struct {
@@ -114,6 +126,15 @@ type HistoryViewResult struct {
 	Value HistoryEntry
 }
 
+type MissingLinkViewResponse struct {
+	ViewResponse
+	Rows []MissingLinkViewResult `json:"rows,omitempty"`
+}
+
+type MissingLinkViewResult struct {
+	Id string `json:"id"`
+}
+
 type SlugViewResponse struct {
 	ViewResponse
 	Rows []SlugViewResult `json:"rows,omitempty"`
@@ -162,12 +183,14 @@ type PageIndexResult struct {
 }
 
 type PageIndexEntry struct {
-	Id        string    `json:"id"`
-	Slug      string    `json:"slug"`
-	Title     string    `json:"title"`
-	Owner     string    `json:"owner"`
-	Editor    string    `json:"editor"`
-	Timestamp time.Time `json:"timestamp"`
+	Id          string       `json:"id"`
+	Slug        string       `json:"slug"`
+	Title       string       `json:"title"`
+	Owner       string       `json:"owner"`
+	Editor      string       `json:"editor"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Tags        []string     `json:"tags,omitempty"`
+	Restriction *Restriction `json:"restriction,omitempty"`
 }
 
 type PageViewResult struct {
@@ -191,6 +214,24 @@ type Comment struct {
 	CreatedTime  time.Time   `json:"createdTime"`
 	ModifiedTime time.Time   `json:"modifiedTime"`
 	Content      PageContent `json:"content"`
+	//Replies belong to a top-level comment's thread
+	ParentComment string `json:"parentComment,omitempty"`
+	//A deleted comment with replies is kept, without its content
+	Deleted bool `json:"deleted,omitempty"`
+	//Users @mentioned in the content
+	Mentions []string `json:"mentions,omitempty"`
+}
+
+// A top-level comment and its replies, oldest first
+type CommentThread struct {
+	Comment    Comment   `json:"comment"`
+	ReplyCount int       `json:"replyCount"`
+	Replies    []Comment `json:"replies"`
+}
+
+type CommentThreadList struct {
+	TotalRows int             `json:"totalRows"`
+	Threads   []CommentThread `json:"threads"`
 }
 
 type CommentIndexViewResponse struct {
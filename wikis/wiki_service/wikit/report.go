@@ -0,0 +1,142 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Wiki maintenance reports
+
+import (
+	"net/url"
+)
+
+//Broken links, orphan pages and missing attachments in a wiki
+type LinkReport struct {
+	BrokenLinks        []BrokenLink        `json:"brokenLinks"`
+	OrphanPages        []PageIndexEntry    `json:"orphanPages"`
+	MissingAttachments []MissingAttachment `json:"missingAttachments"`
+}
+
+//A link to a page that doesn't exist
+type BrokenLink struct {
+	Page PageIndexEntry `json:"page"`
+	Link PageLink       `json:"link"`
+}
+
+//A page attachment whose file no longer exists
+type MissingAttachment struct {
+	Page   PageIndexEntry `json:"page"`
+	FileId string         `json:"fileId"`
+}
+
+type CurrentPagesViewResponse struct {
+	ViewResponse
+	Rows []CurrentPagesViewResult `json:"rows,omitempty"`
+}
+
+type CurrentPagesViewResult struct {
+	Id    string         `json:"id"`
+	Value PageIndexEntry `json:"value"`
+	Doc   Page           `json:"doc"`
+}
+
+//Gets the current versions of every page in the wiki
+func (wiki *Wiki) getCurrentPages() ([]CurrentPagesViewResult, error) {
+	response := CurrentPagesViewResponse{}
+	params := url.Values{}
+	params.Add("reduce", "false")
+	params.Add("include_docs", "true")
+	err := wiki.db.GetView("wikit", "getIndex", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	return response.Rows, nil
+}
+
+//Scans the current pages of a wiki for broken links, orphans (top level
+//pages nothing links to) and attachments to missing files
+func (wiki *Wiki) GetLinkReport(wikiId string) (*LinkReport, error) {
+	pages, err := wiki.getCurrentPages()
+	if err != nil {
+		return nil, err
+	}
+	files, err := wiki.GetFileIndex("", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	fileIds := make(map[string]bool)
+	for _, file := range files.Rows {
+		fileIds[file.Id] = true
+	}
+	pageIds := make(map[string]bool)
+	//Links are resolved when a page is saved, so a page created
+	//since then is found by its slug
+	slugIds := make(map[string]string)
+	for _, page := range pages {
+		pageIds[page.Id] = true
+		for _, slug := range page.Doc.PreviousSlugs {
+			slugIds[slug] = page.Id
+		}
+	}
+	for _, page := range pages {
+		slugIds[page.Doc.Slug] = page.Id
+	}
+	report := &LinkReport{
+		BrokenLinks:        []BrokenLink{},
+		OrphanPages:        []PageIndexEntry{},
+		MissingAttachments: []MissingAttachment{},
+	}
+	linkedTo := make(map[string]bool)
+	for _, page := range pages {
+		for _, link := range page.Doc.Links {
+			if link.PageId == "" && link.WikiId == wikiId {
+				link.PageId = slugIds[link.Slug]
+			}
+			if link.PageId == "" ||
+				(link.WikiId == wikiId && !pageIds[link.PageId]) {
+				report.BrokenLinks = append(report.BrokenLinks,
+					BrokenLink{Page: page.Value, Link: link})
+			} else if link.PageId != page.Id {
+				linkedTo[link.PageId] = true
+			}
+		}
+		for _, fileId := range page.Doc.Attachments {
+			if !fileIds[fileId] {
+				report.MissingAttachments = append(report.MissingAttachments,
+					MissingAttachment{Page: page.Value, FileId: fileId})
+			}
+		}
+	}
+	for _, page := range pages {
+		if page.Doc.Parent == "" && !linkedTo[page.Id] {
+			report.OrphanPages = append(report.OrphanPages, page.Value)
+		}
+	}
+	return report, nil
+}
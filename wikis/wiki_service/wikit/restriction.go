@@ -0,0 +1,219 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Page access restrictions
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"reflect"
+	"sort"
+)
+
+//Limits who may see and edit a page to the named users and roles.
+//A subtree restriction is copied to each of the page's descendants,
+//with the source set to the page it came from.
+type Restriction struct {
+	Users   []string `json:"users"`            //user names
+	Roles   []string `json:"roles"`            //role names
+	Subtree bool     `json:"subtree"`          //also restrict the page's descendants
+	Source  string   `json:"source,omitempty"` //For inherited restrictions: the restricted ancestor
+}
+
+//Whether a user may see and edit a page with this restriction.
+//A nil restriction allows everyone.
+func (r *Restriction) Allows(userName string, roles []string) bool {
+	if r == nil {
+		return true
+	}
+	for _, user := range r.Users {
+		if user == userName {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		for _, userRole := range roles {
+			if role == userRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Whether the restriction was set on the page itself, rather than inherited
+func (r *Restriction) Explicit() bool {
+	return r != nil && r.Source == ""
+}
+
+func (r Restriction) Validate() error {
+	if len(r.Users) == 0 && len(r.Roles) == 0 {
+		return &Error{
+			StatusCode: 400,
+			Reason:     "A restriction needs at least one user or role",
+		}
+	}
+	return nil
+}
+
+//Finds the restriction a page inherits: that of its nearest ancestor
+//with a subtree restriction.  explicit holds the restrictions set on
+//the pages in the lineage, by page id.
+func InheritRestriction(lineage []string,
+	explicit map[string]*Restriction) *Restriction {
+	for i := len(lineage) - 2; i >= 0; i-- {
+		if r, ok := explicit[lineage[i]]; ok && r.Subtree {
+			return &Restriction{
+				Users:   r.Users,
+				Roles:   r.Roles,
+				Subtree: true,
+				Source:  lineage[i],
+			}
+		}
+	}
+	return nil
+}
+
+//Reads the restrictions set on the ancestors in a page's lineage
+func (wiki *Wiki) ancestorRestrictions(lineage []string) (map[string]*Restriction, error) {
+	explicit := make(map[string]*Restriction)
+	if len(lineage) < 2 {
+		return explicit, nil
+	}
+	response := MultiPageResponse{}
+	if err := wiki.ReadMultiplePages(lineage[:len(lineage)-1], &response); err != nil {
+		return nil, err
+	}
+	for _, row := range response.Rows {
+		if row.Doc.Restriction.Explicit() {
+			explicit[row.Id] = row.Doc.Restriction
+		}
+	}
+	return explicit, nil
+}
+
+//Sets the restriction on a page, or removes it if restriction is nil.
+//A page without a restriction of its own inherits its ancestors'.
+//The restrictions inherited by the page's descendants are updated;
+//descendants that couldn't be updated are listed in the SubtreeResult.
+func (wiki *Wiki) SetRestriction(id string, rev string,
+	restriction *Restriction) (string, *SubtreeResult, error) {
+	page := Page{}
+	if _, err := wiki.ReadPage(id, &page); err != nil {
+		return "", nil, err
+	} else if page.OwningPage != id {
+		return "", nil, &Error{
+			StatusCode: 400,
+			Reason:     "Historical revisions can't be restricted",
+		}
+	}
+	if restriction != nil {
+		if err := restriction.Validate(); err != nil {
+			return "", nil, err
+		}
+		restriction.Source = ""
+		page.Restriction = restriction
+	} else {
+		explicit, err := wiki.ancestorRestrictions(page.Lineage)
+		if err != nil {
+			return "", nil, err
+		}
+		page.Restriction = InheritRestriction(page.Lineage, explicit)
+	}
+	//Like a move, this doesn't get a history entry
+	nRev, err := wiki.db.Save(&page, id, rev)
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := wiki.rewriteSubtree(id, &page)
+	return nRev, result, err
+}
+
+//Rewrites a page's descendants after the page has been moved or its
+//restriction changed.  The page's old lineage prefix is replaced with
+//its new one, and the descendants' inherited restrictions are updated.
+func (wiki *Wiki) rewriteSubtree(id string, root *Page) (*SubtreeResult, error) {
+	result := &SubtreeResult{
+		Updated: []string{},
+		Failed:  []SubtreeFailure{},
+	}
+	descendants, err := wiki.GetDescendants(id)
+	if err != nil {
+		return nil, err
+	}
+	explicit, err := wiki.ancestorRestrictions(root.Lineage)
+	if err != nil {
+		return nil, err
+	}
+	if root.Restriction.Explicit() {
+		explicit[id] = root.Restriction
+	}
+	//Parents before their children, so restrictions cascade down
+	sort.Sort(sort.Reverse(byDepth(descendants)))
+	for _, doc := range descendants {
+		//Find where the page sits in this descendant's lineage
+		pos := -1
+		for i, ancestor := range doc.Lineage {
+			if ancestor == id {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 {
+			continue
+		}
+		lineage := make([]string, 0, len(root.Lineage)+len(doc.Lineage)-pos)
+		lineage = append(lineage, root.Lineage...)
+		lineage = append(lineage, doc.Lineage[pos+1:]...)
+		page := doc.Page
+		changed := !reflect.DeepEqual(lineage, page.Lineage)
+		page.Lineage = lineage
+		if page.Restriction.Explicit() {
+			explicit[doc.Id] = page.Restriction
+		} else {
+			inherited := InheritRestriction(lineage, explicit)
+			if !reflect.DeepEqual(inherited, page.Restriction) {
+				page.Restriction = inherited
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		//Each page succeeds or fails on its own
+		if _, err := wiki.db.Save(&page, doc.Id, doc.Rev); err != nil {
+			result.addFailure(doc.Id, err)
+		} else {
+			result.Updated = append(result.Updated, doc.Id)
+		}
+	}
+	return result, nil
+}
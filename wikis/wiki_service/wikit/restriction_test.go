@@ -0,0 +1,74 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+)
+
+func TestRestrictionAllows(t *testing.T) {
+	var none *Restriction
+	if !none.Allows("anyone", nil) {
+		t.Error("No restriction should allow everyone")
+	}
+	r := &Restriction{Users: []string{"alice"}, Roles: []string{"finance"}}
+	if !r.Allows("alice", nil) {
+		t.Error("Named user should be allowed")
+	}
+	if !r.Allows("bob", []string{"all_users", "finance"}) {
+		t.Error("User with a named role should be allowed")
+	}
+	if r.Allows("bob", []string{"all_users"}) {
+		t.Error("Other users should not be allowed")
+	}
+}
+
+func TestInheritRestriction(t *testing.T) {
+	explicit := map[string]*Restriction{
+		"top":   {Users: []string{"alice"}, Subtree: true},
+		"guide": {Users: []string{"bob"}},
+	}
+	inherited := InheritRestriction([]string{"top", "guide", "install"}, explicit)
+	//guide's own restriction doesn't cover its children
+	if inherited == nil || inherited.Source != "top" || inherited.Users[0] != "alice" {
+		t.Errorf("Should inherit top's restriction, got %v", inherited)
+	}
+	if inherited.Explicit() {
+		t.Error("Inherited restriction shouldn't be explicit")
+	}
+	if r := InheritRestriction([]string{"top"}, explicit); r != nil {
+		t.Errorf("A page doesn't inherit its own restriction, got %v", r)
+	}
+	if r := InheritRestriction([]string{"other", "page"}, explicit); r != nil {
+		t.Errorf("Unrestricted subtree should have no restriction, got %v", r)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Heading-delimited sections of page markdown, for editing one part of
+// a long page at a time
+
+import (
+	"github.com/rhinoman/go-commonmark"
+	"html"
+	"strings"
+)
+
+//A section runs from its heading to the next heading of the same or a
+//higher level, so it includes its subsections
+type Section struct {
+	Level   int    `json:"level"`
+	Title   string `json:"title"`
+	Anchor  string `json:"anchor"` //The same as the heading's anchor in the outline
+	Content string `json:"content"`
+	start   int
+	end     int
+}
+
+//Renders source positions.  The binding's CMARK_OPT_SOURCEPOS predates
+//the value in the cmark it bundles.
+const cmarkOptSourcepos = 1 << 1
+
+//Finds the sections of a page's markdown, in document order.
+//The headings are found by the parser that renders the page, and are
+//anchored the same way, so the sections match the page's outline.
+func ReadSections(markdown string) []Section {
+	//Wiki links render as their label
+	mdText := ReplaceWikiLinks(markdown, func(ref WikiLinkRef) string {
+		return html.EscapeString(ref.Label)
+	})
+	document := commonmark.ParseDocument(mdText, commonmark.CMARK_OPT_DEFAULT)
+	htmlText := document.RenderHtml(cmarkOptSourcepos)
+	document.Free()
+	//Where each line of the markdown starts
+	lineStarts := []int{0}
+	for i := 0; i < len(markdown); i++ {
+		if markdown[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	sections := []Section{}
+	for _, entry := range ReadOutline(AnchorHeadings(htmlText)) {
+		//Headings written in html have no line
+		if entry.line < 1 || entry.line > len(lineStarts) {
+			continue
+		}
+		sections = append(sections, Section{
+			Level:  entry.Level,
+			Title:  entry.Text,
+			Anchor: entry.Anchor,
+			start:  lineStarts[entry.line-1],
+		})
+	}
+	for i := range sections {
+		sections[i].end = len(markdown)
+		for _, next := range sections[i+1:] {
+			if next.Level <= sections[i].Level {
+				sections[i].end = next.start
+				break
+			}
+		}
+		sections[i].Content = markdown[sections[i].start:sections[i].end]
+	}
+	return sections
+}
+
+//Finds a section of a page's markdown by its anchor
+func FindSection(markdown string, anchor string) (Section, bool) {
+	for _, section := range ReadSections(markdown) {
+		if section.Anchor == anchor {
+			return section, true
+		}
+	}
+	return Section{}, false
+}
+
+//Replaces a section, found in the same markdown, with new content
+func ReplaceSection(markdown string, section Section, content string) string {
+	if content != "" && section.end < len(markdown) &&
+		!strings.HasSuffix(content, "\n") {
+		//Keep the next heading on its own line
+		content += "\n"
+	}
+	return markdown[:section.start] + content + markdown[section.end:]
+}
@@ -0,0 +1,133 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	"github.com/rhinoman/go-commonmark"
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+)
+
+var runbook = "Intro text\n\n" +
+	"# Setup & *Install*\n\nStep one\n\n" +
+	"## Database\n\nCreate it\n\n" +
+	"```\n# not a heading\n```\n\n" +
+	"Restart\n-------\n\nAgain\n\n" +
+	"# Setup & Install #\n\nRepeated\n"
+
+func TestReadSections(t *testing.T) {
+	sections := ReadSections(runbook)
+	expected := []struct {
+		level  int
+		title  string
+		anchor string
+	}{
+		{1, "Setup & Install", "h-setup-install"},
+		{2, "Database", "h-database"},
+		{2, "Restart", "h-restart"},
+		{1, "Setup & Install", "h-setup-install-1"},
+	}
+	if len(sections) != len(expected) {
+		t.Fatalf("Expected %v sections, got %v", len(expected), sections)
+	}
+	for i, e := range expected {
+		s := sections[i]
+		if s.Level != e.level || s.Title != e.title || s.Anchor != e.anchor {
+			t.Errorf("Section %v: expected %v, got %v", i, e, s)
+		}
+	}
+	if sections[1].Content != "## Database\n\nCreate it\n\n```\n# not a heading\n```\n\n" {
+		t.Errorf("Wrong subsection content: %q", sections[1].Content)
+	}
+	//A section includes its subsections
+	if sections[0].Content != runbook[len("Intro text\n\n"):len(runbook)-len("# Setup & Install #\n\nRepeated\n")] {
+		t.Errorf("Wrong section content: %q", sections[0].Content)
+	}
+}
+
+func TestReplaceSection(t *testing.T) {
+	section, ok := FindSection(runbook, "h-restart")
+	if !ok {
+		t.Fatal("Section not found")
+	}
+	replaced := ReplaceSection(runbook, section, "Restart\n-------\n\nTwice")
+	expected := "Intro text\n\n" +
+		"# Setup & *Install*\n\nStep one\n\n" +
+		"## Database\n\nCreate it\n\n" +
+		"```\n# not a heading\n```\n\n" +
+		"Restart\n-------\n\nTwice\n" +
+		"# Setup & Install #\n\nRepeated\n"
+	if replaced != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, replaced)
+	}
+	if _, ok = FindSection(runbook, "h-nowhere"); ok {
+		t.Error("Shouldn't find a missing section")
+	}
+}
+
+//Sections are named by the same anchors as the rendered page's outline
+func TestSectionsMatchOutline(t *testing.T) {
+	markdown := "# __init__ method\n\nText\n\n" +
+		"> ## Quoted\n>\n> Note\n\n" +
+		"## Setup\n\n- ## Listed\n\n" +
+		"## Setup\n\n## [[Other Page|Elsewhere]]\n\n" +
+		"<h2>Raw</h2>\n\n## Setup\n\nLast\n"
+	//Render it as a page would be
+	mdText := ReplaceWikiLinks(markdown, func(ref WikiLinkRef) string {
+		return `<a href="/app/wikis/w/pages/p" data-wikilink="page">` + ref.Label + `</a>`
+	})
+	document := commonmark.ParseDocument(mdText, 0)
+	outline := ReadOutline(AnchorHeadings(document.RenderHtml(commonmark.CMARK_OPT_DEFAULT)))
+	document.Free()
+	sections := ReadSections(markdown)
+	//Headings written in html aren't sections
+	expected := []string{"h-init-method", "h-quoted", "h-setup", "h-listed",
+		"h-setup-1", "h-elsewhere", "h-setup-2"}
+	if len(sections) != len(expected) || len(outline) != len(expected)+1 {
+		t.Fatalf("Expected %v, got sections %v and outline %v", expected, sections, outline)
+	}
+	for i, section := range sections {
+		if section.Anchor != expected[i] {
+			t.Errorf("Section %v: expected %v, got %v", i, expected[i], section.Anchor)
+		}
+	}
+	for i, entry := range append(outline[:6], outline[7]) {
+		if entry.Anchor != sections[i].Anchor || entry.Text != sections[i].Title {
+			t.Errorf("Section %v doesn't match the outline: %v, %v", i, sections[i], entry)
+		}
+	}
+	if sections[1].Content != "> ## Quoted\n>\n> Note\n\n" {
+		t.Errorf("Wrong quoted section content: %q", sections[1].Content)
+	}
+	if sections[6].Content != "## Setup\n\nLast\n" {
+		t.Errorf("Wrong last section content: %q", sections[6].Content)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Slug history, so renamed pages and wikis can still be found
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"time"
+)
+
+//Adds a page's or wiki's old slug to its previous slugs, after a rename
+//to newSlug.  A slug it has been renamed back to is no longer previous.
+func AddPreviousSlug(previous []string, oldSlug string, newSlug string) []string {
+	slugs := []string{}
+	for _, slug := range previous {
+		if slug != oldSlug && slug != newSlug {
+			slugs = append(slugs, slug)
+		}
+	}
+	if oldSlug != "" && oldSlug != newSlug {
+		slugs = append(slugs, oldSlug)
+	}
+	if len(slugs) == 0 {
+		return nil
+	}
+	return slugs
+}
+
+//Whether a rename time is later than another.
+//Never renamed (nil) is earlier than any rename.
+func RenamedAfter(renamedAt *time.Time, other *time.Time) bool {
+	if renamedAt == nil {
+		return false
+	} else if other == nil {
+		return true
+	}
+	return renamedAt.After(*other)
+}
+
+//Gets the current page that used to have a slug
+func (wiki *Wiki) ReadPageByPreviousSlug(slug string, page *Page) (string, error) {
+	response := SlugViewResponse{}
+	err := wiki.db.GetView("wikit", "getPageByPreviousSlug", &response, SetKey(slug))
+	if err != nil {
+		return "", err
+	}
+	if len(response.Rows) == 0 {
+		return "", &Error{StatusCode: 404, Reason: "Page not found"}
+	}
+	//The most recent rename wins
+	latest := response.Rows[0]
+	for _, row := range response.Rows[1:] {
+		if RenamedAfter(row.Value.Page.RenamedAt, latest.Value.Page.RenamedAt) {
+			latest = row
+		}
+	}
+	*page = latest.Value.Page
+	page.Id = latest.Id
+	return latest.Value.Rev, nil
+}
@@ -0,0 +1,57 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"reflect"
+	"testing"
+)
+
+func TestAddPreviousSlug(t *testing.T) {
+	slugs := AddPreviousSlug(nil, "about", "about-us")
+	if !reflect.DeepEqual(slugs, []string{"about"}) {
+		t.Errorf("Expected [about], got %v", slugs)
+	}
+	slugs = AddPreviousSlug(slugs, "about-us", "about-the-cafe")
+	if !reflect.DeepEqual(slugs, []string{"about", "about-us"}) {
+		t.Errorf("Expected [about about-us], got %v", slugs)
+	}
+	//Renaming back to an old slug makes it current again
+	slugs = AddPreviousSlug(slugs, "about-the-cafe", "about")
+	if !reflect.DeepEqual(slugs, []string{"about-us", "about-the-cafe"}) {
+		t.Errorf("Expected [about-us about-the-cafe], got %v", slugs)
+	}
+	//An unchanged slug isn't added
+	if slugs = AddPreviousSlug(nil, "about", "about"); slugs != nil {
+		t.Errorf("Expected no previous slugs, got %v", slugs)
+	}
+}
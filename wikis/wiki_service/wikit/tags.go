@@ -0,0 +1,162 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Page tags
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	MaxTags      = 32
+	MaxTagLength = 64
+)
+
+var tagRegexp = regexp.MustCompile(`^[\p{Ll}\p{N}][\p{Ll}\p{N}\-_. ]*$`)
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+//Lower cases and trims tags, dropping empty tags and duplicates
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func validateTags(tags []string) error {
+	err := &Error{
+		StatusCode: 400,
+	}
+	if len(tags) > MaxTags {
+		err.Reason = "Too many tags"
+		return err
+	}
+	for _, tag := range tags {
+		if len(tag) > MaxTagLength || !tagRegexp.MatchString(tag) {
+			err.Reason = "Invalid tag: " + tag
+			return err
+		}
+	}
+	return nil
+}
+
+//Lists every tag used in the wiki, with the number of pages carrying it
+func (wiki *Wiki) GetTagCounts() ([]TagCount, error) {
+	response := KVResponse{}
+	params := url.Values{}
+	params.Add("group", "true")
+	err := wiki.db.GetView("wikit", "getPagesByTag", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	counts := []TagCount{}
+	for _, row := range response.Rows {
+		counts = append(counts, TagCount{Tag: row.Key, Count: row.Value})
+	}
+	return counts, nil
+}
+
+//Lists every tagged page, once for each of its tags.
+//Each entry's key is the tag.
+func (wiki *Wiki) GetTaggedPages() (PageIndex, error) {
+	response := PageIndexViewResponse{}
+	params := url.Values{}
+	params.Add("reduce", "false")
+	err := wiki.db.GetView("wikit", "getPagesByTag", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	return response.Rows, nil
+}
+
+//Counts the entries of a tagged page index by tag
+func CountTags(index PageIndex) []TagCount {
+	counts := []TagCount{}
+	for _, entry := range index {
+		if n := len(counts); n > 0 && counts[n-1].Tag == entry.Key {
+			counts[n-1].Count++
+		} else {
+			counts = append(counts, TagCount{Tag: entry.Key, Count: 1})
+		}
+	}
+	return counts
+}
+
+//Gets the pages carrying any (or, if matchAll is set, all) of the tags
+func (wiki *Wiki) GetPagesByTags(tags []string, matchAll bool) (PageIndex, error) {
+	tags = NormalizeTags(tags)
+	matches := make(map[string]int)
+	entries := make(map[string]PageIndexResult)
+	for _, tag := range tags {
+		response := PageIndexViewResponse{}
+		theKeys := SetKey(tag)
+		theKeys.Add("reduce", "false")
+		err := wiki.db.GetView("wikit", "getPagesByTag", &response, theKeys)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range response.Rows {
+			matches[row.Id]++
+			entries[row.Id] = row
+		}
+	}
+	index := PageIndex{}
+	for id, count := range matches {
+		if matchAll && count < len(tags) {
+			continue
+		}
+		index = append(index, entries[id])
+	}
+	sort.Sort(byTitle(index))
+	return index, nil
+}
+
+type byTitle PageIndex
+
+func (p byTitle) Len() int           { return len(p) }
+func (p byTitle) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byTitle) Less(i, j int) bool { return p[i].Value.Title < p[j].Value.Title }
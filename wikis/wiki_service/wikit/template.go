@@ -0,0 +1,212 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Page templates
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+type Template struct {
+	Id          string    `json:"id,omitempty"`
+	DocType     string    `json:"type"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Title       string    `json:"title"`   //Title for new pages, may contain variables
+	Content     string    `json:"content"` //Markdown for new pages, may contain variables
+	Tags        []string  `json:"tags"`
+	Owner       string    `json:"owner"`
+	LastEditor  string    `json:"editor"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type TemplateIndexViewResponse struct {
+	ViewResponse
+	Rows []TemplateIndexResult `json:"rows,omitempty"`
+}
+
+type TemplateIndexResult struct {
+	Id    string             `json:"id"`
+	Key   string             `json:"key"`
+	Value TemplateIndexEntry `json:"value"`
+}
+
+type TemplateIndexEntry struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Title       string `json:"title"`
+}
+
+var templateViews = map[string]View{
+	"getTemplateIndex": {
+		Map: `
+			function(doc){
+				if(doc.type==="template"){
+					emit(doc.name, {
+						id: doc._id,
+						name: doc.name,
+						description: doc.description,
+						title: doc.title
+					});
+				}
+			}`,
+		Reduce: "_count",
+	},
+}
+
+//Installs (or updates) the template views in a database.
+//Wiki databases get these automatically, this is for the main database,
+//which holds the global templates.
+func InitTemplateDb(db *Database) error {
+	return updateViews(db, "wikit_templates", templateViews)
+}
+
+// Validation of Template
+func (template Template) Validate() error {
+	err := &Error{
+		StatusCode: 400,
+	}
+	if template.DocType != "template" {
+		err.Reason = "Type must be template"
+		return err
+	}
+	if template.Name == "" || len(template.Name) > 128 {
+		err.Reason = "Template name invalid"
+		return err
+	}
+	if len(template.Title) > 128 {
+		err.Reason = "Template title invalid"
+		return err
+	}
+	return validateTags(template.Tags)
+}
+
+//Create or update a template
+func (wiki *Wiki) SaveTemplate(template *Template, id string, rev string,
+	editor string) (string, error) {
+	if rev != "" {
+		rTemplate := Template{}
+		if _, err := wiki.ReadTemplate(id, &rTemplate); err != nil {
+			return "", err
+		}
+		template.Owner = rTemplate.Owner
+	} else {
+		template.Owner = editor
+	}
+	template.DocType = "template"
+	template.LastEditor = editor
+	template.Timestamp = time.Now().UTC()
+	template.Tags = NormalizeTags(template.Tags)
+	if err := template.Validate(); err != nil {
+		return "", err
+	}
+	return wiki.db.Save(template, id, rev)
+}
+
+//Read a template
+func (wiki *Wiki) ReadTemplate(id string, template *Template) (string, error) {
+	rev, err := wiki.db.Read(id, template, nil)
+	if err != nil {
+		return "", err
+	} else if template.DocType != "template" {
+		return "", &Error{
+			StatusCode: 404,
+			Reason:     "Template not found",
+		}
+	}
+	template.Id = id
+	return rev, nil
+}
+
+//Delete a template
+func (wiki *Wiki) DeleteTemplate(id string, rev string) (string, error) {
+	template := Template{}
+	if _, err := wiki.ReadTemplate(id, &template); err != nil {
+		return "", err
+	}
+	return wiki.db.Delete(id, rev)
+}
+
+//Gets a list of templates
+func (wiki *Wiki) GetTemplateIndex() ([]TemplateIndexResult, error) {
+	response := TemplateIndexViewResponse{}
+	params := url.Values{}
+	params.Add("reduce", "false")
+	err := wiki.db.GetView("wikit_templates", "getTemplateIndex", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	return response.Rows, nil
+}
+
+var templateVarRegexp = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+//Substitutes {{variables}} in template text.
+//Unknown variables are left alone.
+func ExpandTemplate(text string, vars map[string]string) string {
+	return templateVarRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		name := templateVarRegexp.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+//Builds a new page from a template.
+//The title variable is the page title given by the user, or else
+//the template's title.
+func (template *Template) NewPage(title string, user string,
+	now time.Time) *Page {
+	vars := map[string]string{
+		"date": now.Format("2006-01-02"),
+		"time": now.Format("15:04"),
+		"user": user,
+	}
+	if title == "" {
+		title = ExpandTemplate(template.Title, vars)
+	}
+	vars["title"] = title
+	tags := make([]string, len(template.Tags))
+	copy(tags, template.Tags)
+	return &Page{
+		Title: title,
+		Content: PageContent{
+			Raw: ExpandTemplate(template.Content, vars),
+		},
+		Tags: tags,
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"testing"
+	"time"
+)
+
+func TestTemplateNewPage(t *testing.T) {
+	template := Template{
+		Title:   "Meeting {{date}}",
+		Content: "# {{ title }}\nTaken by {{user}} at {{time}}. {{unknown}}\n",
+		Tags:    []string{"meeting"},
+	}
+	now := time.Date(2016, 3, 14, 9, 30, 0, 0, time.UTC)
+	page := template.NewPage("", "John.Smith", now)
+	if page.Title != "Meeting 2016-03-14" {
+		t.Errorf("Unexpected title: %v", page.Title)
+	}
+	expected := "# Meeting 2016-03-14\nTaken by John.Smith at 09:30. {{unknown}}\n"
+	if page.Content.Raw != expected {
+		t.Errorf("Unexpected content: %v", page.Content.Raw)
+	}
+	if len(page.Tags) != 1 || page.Tags[0] != "meeting" {
+		t.Errorf("Unexpected tags: %v", page.Tags)
+	}
+	page = template.NewPage("Retro", "John.Smith", now)
+	if page.Title != "Retro" || page.Content.Raw[:8] != "# Retro\n" {
+		t.Errorf("Given title not used: %v, %v", page.Title, page.Content.Raw)
+	}
+}
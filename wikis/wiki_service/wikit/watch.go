@@ -0,0 +1,172 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Page watches: users subscribed to changes to a page or its subtree
+
+import (
+	. "github.com/rhinoman/couchdb-go"
+	"strconv"
+	"time"
+)
+
+type Watch struct {
+	Id        string    `json:"id,omitempty"`
+	DocType   string    `json:"type"`
+	User      string    `json:"user"`    //a user name
+	PageId    string    `json:"pageId"`  //the page being watched
+	Subtree   bool      `json:"subtree"` //also watch the page's descendants
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type WatchViewResponse struct {
+	ViewResponse
+	Rows []WatchViewResult `json:"rows,omitempty"`
+}
+
+type WatchViewResult struct {
+	Id    string `json:"id"`
+	Key   string `json:"key"`
+	Value Watch  `json:"value"`
+}
+
+func WatchId(pageId string, user string) string {
+	return "watch:" + pageId + ":" + user
+}
+
+//Saves a user's watch on a page, replacing any previous one
+func (wiki *Wiki) SaveWatch(watch *Watch, pageId string,
+	user string) (string, error) {
+	rev := ""
+	oldWatch := Watch{}
+	if oldRev, err := wiki.ReadWatch(pageId, user, &oldWatch); err == nil {
+		rev = oldRev
+	} else if cErr, ok := err.(*Error); !ok || cErr.StatusCode != 404 {
+		return "", err
+	}
+	watch.DocType = "watch"
+	watch.User = user
+	watch.PageId = pageId
+	watch.Timestamp = time.Now().UTC()
+	return wiki.db.Save(watch, WatchId(pageId, user), rev)
+}
+
+//Reads a user's watch on a page
+func (wiki *Wiki) ReadWatch(pageId string, user string,
+	watch *Watch) (string, error) {
+	id := WatchId(pageId, user)
+	rev, err := wiki.db.Read(id, watch, nil)
+	if err != nil {
+		return "", err
+	} else if watch.DocType != "watch" || watch.User != user {
+		return "", &Error{
+			StatusCode: 404,
+			Reason:     "Watch not found",
+		}
+	}
+	watch.Id = id
+	return rev, nil
+}
+
+//Removes a user's watch on a page
+func (wiki *Wiki) DeleteWatch(pageId string, user string) (string, error) {
+	watch := Watch{}
+	rev, err := wiki.ReadWatch(pageId, user, &watch)
+	if err != nil {
+		return "", err
+	}
+	return wiki.db.Delete(watch.Id, rev)
+}
+
+//Lists a user's watches in this wiki
+func (wiki *Wiki) GetUserWatches(user string) ([]Watch, error) {
+	return wiki.getWatches("getWatchesByUser", user)
+}
+
+//Finds the watches covering a page: those on the page itself and
+//subtree watches on its ancestors
+func (wiki *Wiki) GetWatchers(lineage []string) ([]Watch, error) {
+	watches := []Watch{}
+	for i, pageId := range lineage {
+		pageWatches, err := wiki.getWatches("getWatchesByPage", pageId)
+		if err != nil {
+			return nil, err
+		}
+		for _, watch := range pageWatches {
+			if i == len(lineage)-1 || watch.Subtree {
+				watches = append(watches, watch)
+			}
+		}
+	}
+	return watches, nil
+}
+
+func (wiki *Wiki) getWatches(view string, key string) ([]Watch, error) {
+	response := WatchViewResponse{}
+	if err := wiki.db.GetView("wikit", view, &response, SetKey(key)); err != nil {
+		return nil, err
+	}
+	watches := make([]Watch, len(response.Rows))
+	for i, row := range response.Rows {
+		watches[i] = row.Value
+		watches[i].Id = row.Id
+	}
+	return watches, nil
+}
+
+//Describes the difference between two versions of a page,
+//e.g. "Renamed from "Old Title". 3 lines added, 1 line removed"
+func ChangeSummary(from *Page, to *Page) string {
+	summary := ""
+	if from.Title != to.Title {
+		summary = "Renamed from \"" + from.Title + "\". "
+	}
+	added, removed := 0, 0
+	for _, chunk := range DiffLines(from.Content.Raw, to.Content.Raw) {
+		switch chunk.Op {
+		case DiffInsert:
+			added += len(SplitLines(chunk.Text))
+		case DiffDelete:
+			removed += len(SplitLines(chunk.Text))
+		}
+	}
+	if added == 0 && removed == 0 {
+		return summary + "No changes to the content"
+	}
+	return summary + countLines(added) + " added, " + strconv.Itoa(removed) + " removed"
+}
+
+func countLines(n int) string {
+	if n == 1 {
+		return "1 line"
+	}
+	return strconv.Itoa(n) + " lines"
+}
@@ -31,6 +31,7 @@
 package wikit
 
 import (
+	"encoding/json"
 	"errors"
 	. "github.com/rhinoman/couchdb-go"
 	"github.com/rhinoman/go-slugification"
@@ -39,6 +40,8 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -99,12 +102,79 @@ func (wiki *Wiki) ReadPage(id string, page *Page) (string, error) {
 	rev, err := wiki.db.Read(id, &page, nil)
 	if err != nil {
 		return "", err
+	} else if page.DocType != "page" {
+		//Drafts and other documents aren't pages
+		return "", &Error{
+			StatusCode: 404,
+			Reason:     "Page not found",
+		}
 	} else {
 		page.Id = id
 		return rev, nil
 	}
 }
 
+//Retrieves a revision of a page.
+//docId may be the page itself or one of its historical copies
+func (wiki *Wiki) ReadRevision(pageId string, docId string,
+	page *Page) (string, error) {
+	rev, err := wiki.ReadPage(docId, page)
+	if err != nil {
+		return "", err
+	} else if page.OwningPage != pageId {
+		return "", &Error{
+			StatusCode: 400,
+			Reason:     "Revision does not belong to this page",
+		}
+	}
+	return rev, nil
+}
+
+//Reads the page as it was at a given revision.
+//Uses the history copy taken from that revision, falling back
+//to the database's own revision, if it's still around.
+func (wiki *Wiki) ReadPageAtRevision(pageId string, pageRev string,
+	page *Page) error {
+	history, err := wiki.GetHistory(pageId, 1, 0)
+	if err != nil {
+		return err
+	}
+	for _, entry := range history.Rows {
+		if entry.Value.PageRev == pageRev {
+			_, err = wiki.ReadRevision(pageId, entry.Value.DocumentId, page)
+			return err
+		}
+	}
+	params := url.Values{}
+	params.Add("rev", pageRev)
+	if _, err = wiki.db.Read(pageId, page, &params); err != nil {
+		return err
+	}
+	page.Id = pageId
+	return nil
+}
+
+//Prepares a page for reverting to a historical revision.
+//The current page is read into page, with the title, content, tags and
+//attachments of the historical revision.
+//Save the page as usual to complete the revert.
+func (wiki *Wiki) PrepareRevert(pageId string, historyId string,
+	page *Page) error {
+	oldPage := Page{}
+	if _, err := wiki.ReadRevision(pageId, historyId, &oldPage); err != nil {
+		return err
+	}
+	if _, err := wiki.ReadPage(pageId, page); err != nil {
+		return err
+	}
+	page.Title = oldPage.Title
+	page.Content = oldPage.Content
+	page.Attachments = oldPage.Attachments
+	page.Tags = oldPage.Tags
+	page.RevertedFrom = historyId
+	return nil
+}
+
 // Retrieves multiple pages in one request, given an array of page ids
 func (wiki *Wiki) ReadMultiplePages(ids []string, mpr *MultiPageResponse) error {
 	return wiki.db.ReadMultiple(ids, mpr)
@@ -126,6 +196,16 @@ func (wiki *Wiki) ReadPageBySlug(slug string, page *Page) (string, error) {
 	}
 }
 
+//Verifies the current user is allowed to read this wiki
+//Returns an error if not
+func (wiki *Wiki) CheckReadAccess() error {
+	response := PageIndexViewResponse{}
+	params := url.Values{}
+	params.Add("limit", "0")
+	params.Add("reduce", "false")
+	return wiki.db.GetView("wikit", "getIndex", &response, &params)
+}
+
 // Get a page's lineage information.
 func (wiki *Wiki) GetLineage(pageId string, page *Page) ([]string, error) {
 	if parent := page.Parent; parent != "" {
@@ -187,7 +267,7 @@ func (page Page) Validate() error {
 		err.Reason = "Owning Page not set"
 		return err
 	}
-	return nil
+	return validateTags(page.Tags)
 }
 
 // Validation of Comment
@@ -212,13 +292,26 @@ func (wiki *Wiki) createPage(page *Page, id string, editor string) (string, erro
 	page.Timestamp = time.Now().UTC()
 	page.Owner = editor
 	page.LastEditor = editor
+	page.Change = ChangeCreated
+	page.Tags = NormalizeTags(page.Tags)
 	page.Slug = slugification.Slugify(page.Title)
+	//A new page has no slug history, or it could take over another's
+	page.PreviousSlugs = nil
+	page.RenamedAt = nil
 	//A new document is its own owner.
 	page.OwningPage = id
 	//Set the lineage
 	if lineage, err := wiki.GetLineage(id, page); err == nil {
 		page.Lineage = lineage
 	}
+	//Pages created in a restricted subtree are restricted, too
+	if !page.Restriction.Explicit() {
+		explicit, err := wiki.ancestorRestrictions(page.Lineage)
+		if err != nil {
+			return "", err
+		}
+		page.Restriction = InheritRestriction(page.Lineage, explicit)
+	}
 	if err := page.Validate(); err != nil {
 		return "", err
 	}
@@ -249,9 +342,30 @@ func (wiki *Wiki) updatePage(page *Page, id string, rev string, editor string) (
 	page.DocType = "page"
 	page.LastEditor = editor
 	page.Timestamp = time.Now().UTC()
+	page.Change = ChangeEdited
 	page.Slug = slugification.Slugify(page.Title)
 	page.OwningPage = id
 	page.Owner = rPage.Owner
+	//The page hierarchy can only be changed by moving the page
+	if (page.Parent != "" || len(page.Lineage) > 0) &&
+		(page.Parent != rPage.Parent || !reflect.DeepEqual(page.Lineage, rPage.Lineage)) {
+		return "", &Error{
+			StatusCode: 400,
+			Reason:     "The parent of a page can't be changed by saving it, move the page instead",
+		}
+	}
+	page.Parent = rPage.Parent
+	page.Lineage = rPage.Lineage
+	//As can the restriction, which is set on its own
+	page.Restriction = rPage.Restriction
+	//Remember the old slug, so links to it can be redirected
+	page.PreviousSlugs = AddPreviousSlug(rPage.PreviousSlugs, rPage.Slug, page.Slug)
+	page.RenamedAt = rPage.RenamedAt
+	if page.Slug != rPage.Slug {
+		renamedAt := page.Timestamp
+		page.RenamedAt = &renamedAt
+	}
+	page.Tags = NormalizeTags(page.Tags)
 	if err = page.Validate(); err != nil {
 		return "", err
 	}
@@ -272,6 +386,7 @@ func (wiki *Wiki) updatePage(page *Page, id string, rev string, editor string) (
 	//Remeber this slug just in case
 	prevSlug := copyPage.Slug
 	copyPage.Slug = ""
+	copyPage.PageRev = rev
 	wiki.db.Save(copyPage, copyId, copyRev)
 	//now save
 	rev, err = wiki.db.Save(page, id, rev)
@@ -281,6 +396,7 @@ func (wiki *Wiki) updatePage(page *Page, id string, rev string, editor string) (
 		wiki.db.Delete(copyId, copyRev)
 		//restore the previous page
 		copyPage.Slug = prevSlug
+		copyPage.PageRev = ""
 		if _, cpErr := wiki.db.Save(copyPage, id, rev); cpErr != nil {
 			return "", cpErr
 		}
@@ -378,6 +494,52 @@ func (wiki *Wiki) GetChildPageIndex(pageId string) (PageIndex, error) {
 	}
 }
 
+//Gets a list of the pages which link to this page
+func (wiki *Wiki) GetBacklinks(pageId string) (PageIndex, error) {
+	response := PageIndexViewResponse{}
+	theKeys := SetKey(pageId)
+	theKeys.Add("reduce", "false")
+	err := wiki.db.GetView("wikit", "getBacklinks", &response, theKeys)
+	if err != nil {
+		return nil, err
+	} else if len(response.Rows) <= 0 {
+		return nil, nil
+	} else {
+		index := response.Rows
+		return index, nil
+	}
+}
+
+//Gets the ids of the pages with links to a page that didn't exist
+//when they were last rendered
+func (wiki *Wiki) GetMissingLinkPages(wikiId string, slug string) ([]string, error) {
+	response := MissingLinkViewResponse{}
+	params := url.Values{}
+	params.Add("key", "["+quotifyString(wikiId)+","+quotifyString(slug)+"]")
+	err := wiki.db.GetView("wikit", "getMissingLinks", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	pageIds := []string{}
+	for _, row := range response.Rows {
+		pageIds = append(pageIds, row.Id)
+	}
+	return pageIds, nil
+}
+
+//Replaces the rendered content and links of a page without creating
+//a history entry, for when the pages it links to have been created since
+func (wiki *Wiki) UpdateRendering(id string, rev string, formatted string,
+	links []PageLink) (string, error) {
+	page := Page{}
+	if _, err := wiki.ReadPage(id, &page); err != nil {
+		return "", err
+	}
+	page.Content.Formatted = formatted
+	page.Links = links
+	return wiki.db.Save(&page, id, rev)
+}
+
 //Gets a list of all pages in a wiki.
 //Returns the Page List or an error
 func (wiki *Wiki) GetPageIndex() (PageIndex, error) {
@@ -512,6 +674,12 @@ func (wiki *Wiki) createComment(comment *Comment, id string,
 	comment.ModifiedTime = nowTime
 	comment.Author = author
 	comment.OwningPage = pageId
+	comment.Deleted = false
+	if comment.ParentComment != "" {
+		if err := wiki.setCommentThread(comment); err != nil {
+			return "", err
+		}
+	}
 	if err := comment.Validate(); err != nil {
 		return "", err
 	} else {
@@ -526,9 +694,15 @@ func (wiki *Wiki) updateComment(comment *Comment, id string,
 	readComment := Comment{}
 	if _, err := wiki.db.Read(id, &readComment, nil); err != nil {
 		return "", err
+	} else if readComment.Deleted {
+		return "", &Error{
+			StatusCode: 400,
+			Reason:     "Comment has been deleted",
+		}
 	} else {
 		readComment.ModifiedTime = time.Now().UTC()
 		readComment.Content = comment.Content
+		readComment.Mentions = comment.Mentions
 		if err := readComment.Validate(); err != nil {
 			return "", err
 		} else {
@@ -537,9 +711,180 @@ func (wiki *Wiki) updateComment(comment *Comment, id string,
 	}
 }
 
+// Replies join the thread of the comment they reply to
+func (wiki *Wiki) setCommentThread(comment *Comment) error {
+	parent := Comment{}
+	if _, err := wiki.ReadComment(comment.ParentComment, &parent); err != nil {
+		return err
+	}
+	if parent.DocType != "comment" || parent.OwningPage != comment.OwningPage {
+		return &Error{
+			StatusCode: 400,
+			Reason:     "Parent comment is not on this page",
+		}
+	} else if parent.Deleted {
+		return &Error{
+			StatusCode: 400,
+			Reason:     "Parent comment has been deleted",
+		}
+	}
+	if parent.ParentComment != "" {
+		comment.ParentComment = parent.ParentComment
+	}
+	return nil
+}
+
 // Delete a comment
+// A comment with replies is left as a tombstone, so its thread survives
 func (wiki *Wiki) DeleteComment(id string, rev string) (string, error) {
-	return wiki.db.Delete(id, rev)
+	comment := Comment{}
+	if _, err := wiki.ReadComment(id, &comment); err != nil {
+		return "", err
+	}
+	replies, err := wiki.countReplies(comment.OwningPage, id)
+	if err != nil {
+		return "", err
+	}
+	if replies > 0 {
+		comment.Deleted = true
+		comment.Content = PageContent{}
+		comment.Mentions = nil
+		comment.ModifiedTime = time.Now().UTC()
+		return wiki.db.Save(&comment, id, rev)
+	}
+	dRev, err := wiki.db.Delete(id, rev)
+	if err != nil {
+		return "", err
+	}
+	if comment.ParentComment != "" {
+		wiki.removeEmptyTombstone(comment.OwningPage, comment.ParentComment)
+	}
+	return dRev, nil
+}
+
+// Deletes a tombstone once its last reply is gone
+func (wiki *Wiki) removeEmptyTombstone(pageId string, id string) {
+	parent := Comment{}
+	rev, err := wiki.ReadComment(id, &parent)
+	if err != nil || !parent.Deleted {
+		return
+	}
+	if replies, err := wiki.countReplies(pageId, id); err != nil || replies > 0 {
+		return
+	}
+	if _, err = wiki.db.Delete(id, rev); err != nil {
+		log.Printf("Error removing comment tombstone %v: %v", id, err)
+	}
+}
+
+// Gets the replies to each of a page's comments, oldest first,
+// in a single request.  Returns the replies keyed by the comment id.
+func (wiki *Wiki) getReplies(pageId string, ids []string) (map[string][]Comment, error) {
+	replies := make(map[string][]Comment)
+	if len(ids) == 0 {
+		return replies, nil
+	}
+	keys := [][]string{}
+	for _, id := range ids {
+		keys = append(keys, []string{pageId, id})
+	}
+	keyJson, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Add("keys", string(keyJson))
+	response := CommentIndexViewResponse{}
+	err = wiki.db.GetView("wikit_comments", "getRepliesByThread", &response, &params)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range response.Rows {
+		row.Value.Id = row.Id
+		parent := row.Value.ParentComment
+		replies[parent] = append(replies[parent], row.Value)
+	}
+	for _, threadReplies := range replies {
+		sort.Stable(byCommentTime(threadReplies))
+	}
+	return replies, nil
+}
+
+type byCommentTime []Comment
+
+func (c byCommentTime) Len() int      { return len(c) }
+func (c byCommentTime) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byCommentTime) Less(i, j int) bool {
+	return c[i].CreatedTime.Before(c[j].CreatedTime)
+}
+
+// Counts the replies to a comment
+func (wiki *Wiki) countReplies(pageId string, id string) (int, error) {
+	params := SetKeys([]string{pageId, id}, []string{pageId, id, "{}"})
+	params.Set("descending", "false")
+	params.Add("reduce", "true")
+	var countResp struct {
+		Rows []struct {
+			Value int `json:"value"`
+		} `json:"rows"`
+	}
+	err := wiki.db.GetView("wikit_comments", "getCommentReplies", &countResp, params)
+	if err != nil {
+		return 0, err
+	} else if len(countResp.Rows) == 0 {
+		return 0, nil
+	}
+	return countResp.Rows[0].Value, nil
+}
+
+// Get a page's comments as threads: the top-level comments, paginated,
+// each with all of its replies
+func (wiki *Wiki) GetCommentThreads(pageId string, pageNum int,
+	numPerPage int) (*CommentThreadList, error) {
+	countChan := make(chan int)
+	go wiki.getCountForView("wikit_comments", "getCommentThreads", pageId, countChan)
+	params := SetKeys([]string{pageId}, []string{pageId, "{}"})
+	params.Set("descending", "false")
+	params.Add("reduce", "false")
+	if numPerPage != 0 {
+		params.Add("limit", strconv.Itoa(numPerPage))
+	}
+	skip := numPerPage * (pageNum - 1)
+	if skip > 0 {
+		params.Add("skip", strconv.Itoa(skip))
+	}
+	topLevel := CommentIndexViewResponse{}
+	err := wiki.db.GetView("wikit_comments", "getCommentThreads", &topLevel, params)
+	totalRows := <-countChan
+	if err != nil {
+		return nil, err
+	}
+	threads := &CommentThreadList{
+		TotalRows: totalRows,
+		Threads:   []CommentThread{},
+	}
+	//Fetch the replies of the listed threads only
+	ids := []string{}
+	for _, row := range topLevel.Rows {
+		ids = append(ids, row.Id)
+	}
+	replies, err := wiki.getReplies(pageId, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range topLevel.Rows {
+		row.Value.Id = row.Id
+		threadReplies, ok := replies[row.Id]
+		if !ok {
+			threadReplies = []Comment{}
+		}
+		threads.Threads = append(threads.Threads, CommentThread{
+			Comment:    row.Value,
+			ReplyCount: len(threadReplies),
+			Replies:    threadReplies,
+		})
+	}
+	return threads, nil
 }
 
 // Get All Comments for a page
@@ -0,0 +1,672 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit
+
+// Conversion of MediaWiki wikitext to CommonMark
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//The result of converting a wikitext document
+type WikitextConversion struct {
+	Markdown    string
+	Tags        []string //From the page's categories
+	Redirect    string   //Target of a #REDIRECT page
+	Unsupported []string //Constructs which weren't (fully) converted
+}
+
+type wikitextConverter struct {
+	tags        []string
+	unsupported []string
+	noted       map[string]bool
+	protected   []string
+}
+
+//Emphasis markup for markdown or html output
+type emphasisMarkers struct {
+	italicOpen, italicClose string
+	boldOpen, boldClose     string
+}
+
+var markdownEmphasis = emphasisMarkers{"*", "*", "**", "**"}
+var htmlEmphasis = emphasisMarkers{"<em>", "</em>", "<strong>", "</strong>"}
+
+var (
+	redirectRegexp    = regexp.MustCompile(`(?i)^\s*#REDIRECT\s*:?\s*\[\[([^\]|]+)`)
+	commentRegexp     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	nowikiRegexp      = regexp.MustCompile(`(?s)<nowiki>(.*?)</nowiki>`)
+	preRegexp         = regexp.MustCompile(`(?s)<pre>(.*?)</pre>`)
+	sourceRegexp      = regexp.MustCompile(`(?s)<(source|syntaxhighlight)(?:\s+lang="?([\w+#-]*)"?)?[^>]*>(.*?)</(?:source|syntaxhighlight)>`)
+	otherTagRegexp    = regexp.MustCompile(`(?i)<(ref|references|gallery|math|timeline|poem|imagemap|inputbox|categorytree)\b`)
+	magicWordRegexp   = regexp.MustCompile(`__[A-Z]+__`)
+	wtHeadingRegexp   = regexp.MustCompile(`^(={1,6})\s*(.+?)\s*(={1,6})\s*$`)
+	wtListRegexp      = regexp.MustCompile(`^([*#:;]+)\s*(.*)$`)
+	wtWikiLinkRegexp  = regexp.MustCompile(`\[\[([^\[\]|]*)(?:\|([^\[\]]*))?\]\]([a-z]*)`)
+	wtExtLinkRegexp   = regexp.MustCompile(`\[((?:https?|ftp)://[^\s\]]+|mailto:[^\s\]]+)(?:\s+([^\]]*))?\]`)
+	apostrophesRegexp = regexp.MustCompile(`'{2,}`)
+	leadingMdRegexp   = regexp.MustCompile(`^([-+*>=_]|\d{1,9}[.)])`)
+	emptyTagsRegexp   = regexp.MustCompile(`<(em|strong)></(em|strong)>`)
+	placeholderRegexp = regexp.MustCompile("\x00([0-9]+)\x00")
+	tagCharsRegexp    = regexp.MustCompile(`[^\p{Ll}\p{N}\-_. ]+`)
+	pipeTrickRegexp   = regexp.MustCompile(`\s*\(.*\)$`)
+)
+
+//Converts a MediaWiki wikitext document to CommonMark.
+//Headings, links, lists, bold and italic text, preformatted text and
+//tables are converted; tables become html tables.  Categories become tags.
+//Templates, images and other constructs are left as they are (templates
+//as code) and listed in the conversion's Unsupported list.
+func WikitextToMarkdown(text string) *WikitextConversion {
+	c := wikitextConverter{noted: make(map[string]bool)}
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if match := redirectRegexp.FindStringSubmatch(text); match != nil {
+		target := strings.TrimSpace(strings.Replace(match[1], "_", " ", -1))
+		return &WikitextConversion{
+			Markdown:    "Redirects to [[" + target + "]]\n",
+			Tags:        []string{},
+			Redirect:    target,
+			Unsupported: []string{},
+		}
+	}
+	text = c.protect(text)
+	var out []string
+	lines := strings.Split(text, "\n")
+	//What kind of block the previous line belonged to
+	prev := ""
+	emit := func(kind string, block ...string) {
+		//Keep blocks from running into each other
+		if len(out) > 0 && out[len(out)-1] != "" && (kind != prev ||
+			kind == "table" || kind == "heading" || kind == "rule" ||
+			kind == "definition") {
+			out = append(out, "")
+		}
+		out = append(out, block...)
+		prev = kind
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			out = append(out, "")
+			prev = ""
+			continue
+		}
+		if strings.HasPrefix(trimmed, "{|") {
+			end := i + 1
+			for depth := 1; end < len(lines); end++ {
+				t := strings.TrimSpace(lines[end])
+				if strings.HasPrefix(t, "{|") {
+					depth++
+				} else if strings.HasPrefix(t, "|}") {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			emit("table", c.table(lines[i:end]))
+			i = end
+			continue
+		}
+		if match := wtHeadingRegexp.FindStringSubmatch(line); match != nil &&
+			len(match[1]) == len(match[3]) {
+			level := len(match[1])
+			emit("heading", strings.Repeat("#", level)+" "+
+				c.inline(match[2], markdownEmphasis))
+			continue
+		}
+		if strings.HasPrefix(trimmed, "----") {
+			emit("rule", "***")
+			continue
+		}
+		if match := wtListRegexp.FindStringSubmatch(line); match != nil {
+			kind, block := c.listItem(match[1], match[2])
+			emit(kind, block)
+			continue
+		}
+		if strings.HasPrefix(line, " ") {
+			//Preformatted text
+			pre := []string{"```"}
+			for ; i < len(lines) && strings.HasPrefix(lines[i], " ") &&
+				strings.TrimSpace(lines[i]) != ""; i++ {
+				pre = append(pre, html.UnescapeString(lines[i][1:]))
+			}
+			i--
+			emit("pre", append(pre, "```")...)
+			continue
+		}
+		paragraph := strings.TrimSpace(c.inline(line, markdownEmphasis))
+		if paragraph == "" {
+			//Nothing left but categories and the like
+			continue
+		}
+		if leadingMdRegexp.MatchString(trimmed) {
+			//Plain text which would otherwise start a markdown block
+			paragraph = "\\" + paragraph
+		}
+		emit("paragraph", paragraph)
+	}
+	markdown := strings.Trim(strings.Join(out, "\n"), "\n") + "\n"
+	return &WikitextConversion{
+		Markdown:    c.restore(markdown),
+		Tags:        c.tags,
+		Unsupported: c.unsupported,
+	}
+}
+
+//Converts a list item (or an indented or definition line)
+func (c *wikitextConverter) listItem(prefix string, text string) (string, string) {
+	content := c.inline(text, markdownEmphasis)
+	if strings.Trim(prefix, ":") == "" {
+		//Indentation, as on talk pages
+		return "quote", strings.Repeat("> ", len(prefix)) + content
+	}
+	if strings.Contains(prefix, ";") {
+		c.note("Definition list")
+		if sep := strings.Index(content, " : "); sep >= 0 {
+			return "definition", "**" + content[:sep] + "**: " + content[sep+3:]
+		}
+		return "definition", "**" + content + "**"
+	}
+	indent := 0
+	for _, ch := range prefix[:len(prefix)-1] {
+		if ch == '#' {
+			indent += 3
+		} else {
+			indent += 2
+		}
+	}
+	marker := ""
+	switch prefix[len(prefix)-1] {
+	case '*':
+		marker = "- "
+	case '#':
+		marker = "1. "
+	}
+	return "list", strings.Repeat(" ", indent) + marker + content
+}
+
+//Converts a table to html
+func (c *wikitextConverter) table(lines []string) string {
+	type cell struct {
+		header  bool
+		content []string
+	}
+	var rows [][]*cell
+	caption := ""
+	var last *cell
+	addCells := func(text string, header bool) {
+		if len(rows) == 0 {
+			rows = append(rows, []*cell{})
+		}
+		sep := "||"
+		if header {
+			text = strings.Replace(text, "!!", "||", -1)
+		}
+		for _, part := range strings.Split(text, sep) {
+			last = &cell{header: header, content: []string{c.stripCellAttrs(part)}}
+			rows[len(rows)-1] = append(rows[len(rows)-1], last)
+		}
+	}
+	if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[0]), "{|")) != "" {
+		c.note("Table attributes")
+	}
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "|}"):
+		case strings.HasPrefix(trimmed, "{|"):
+			c.note("Nested table")
+		case strings.HasPrefix(trimmed, "|+"):
+			caption = c.stripCellAttrs(trimmed[2:])
+			last = nil
+		case strings.HasPrefix(trimmed, "|-"):
+			rows = append(rows, []*cell{})
+			last = nil
+		case strings.HasPrefix(trimmed, "!"):
+			addCells(trimmed[1:], true)
+		case strings.HasPrefix(trimmed, "|"):
+			addCells(trimmed[1:], false)
+		case trimmed != "" && last != nil:
+			last.content = append(last.content, trimmed)
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<table>\n")
+	if caption != "" {
+		buf.WriteString("<caption>" + c.inline(caption, htmlEmphasis) + "</caption>\n")
+	}
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		buf.WriteString("<tr>")
+		for _, cl := range row {
+			tag := "td"
+			if cl.header {
+				tag = "th"
+			}
+			content := []string{}
+			for _, text := range cl.content {
+				content = append(content, c.inline(strings.TrimSpace(text), htmlEmphasis))
+			}
+			buf.WriteString("<" + tag + ">" + strings.Join(content, "<br>") + "</" + tag + ">")
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</table>")
+	return buf.String()
+}
+
+//Drops the attributes from a table cell: 'style="..." | content'
+func (c *wikitextConverter) stripCellAttrs(text string) string {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "[["):
+			depth++
+			i++
+		case strings.HasPrefix(text[i:], "]]"):
+			depth--
+			i++
+		case text[i] == '|' && depth <= 0:
+			c.note("Table cell attributes")
+			return strings.TrimSpace(text[i+1:])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+//Converts the links and emphasis of a line
+func (c *wikitextConverter) inline(text string, markers emphasisMarkers) string {
+	asHtml := markers == htmlEmphasis
+	text = wtWikiLinkRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		parts := wtWikiLinkRegexp.FindStringSubmatch(match)
+		if link := c.wikiLink(parts[1], parts[2], match, parts[3]); link != "" {
+			return c.hold(link)
+		}
+		return ""
+	})
+	text = wtExtLinkRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		parts := wtExtLinkRegexp.FindStringSubmatch(match)
+		target, label := parts[1], strings.TrimSpace(parts[2])
+		if asHtml {
+			if label == "" {
+				label = html.EscapeString(target)
+			}
+			return c.hold(`<a href="` + html.EscapeString(target) + `">` +
+				c.emphasis(label, markers) + `</a>`)
+		}
+		if label == "" {
+			return c.hold("<" + target + ">")
+		}
+		return c.hold("[" + c.emphasis(escapeMarkdown(label), markers) +
+			"](" + strings.Replace(target, ")", "%29", -1) + ")")
+	})
+	if !asHtml {
+		text = strings.Replace(text, "*", "\\*", -1)
+	}
+	return c.emphasis(text, markers)
+}
+
+//Converts a wiki link, noting the ones that can't be
+func (c *wikitextConverter) wikiLink(target string, label string,
+	match string, trail string) string {
+	target = strings.TrimSpace(strings.Replace(target, "_", " ", -1))
+	hasLabel := strings.Contains(match, "|")
+	label = stripEmphasis(label)
+	if sep := strings.Index(target, ":"); sep > 0 {
+		namespace := strings.ToLower(strings.TrimSpace(target[:sep]))
+		name := strings.TrimSpace(target[sep+1:])
+		switch namespace {
+		case "category":
+			c.addTag(name)
+			return ""
+		case "file", "image", "media":
+			c.note("File link [[" + target + "]]")
+			if caption := fileCaption(label); caption != "" {
+				return caption + trail
+			}
+			return ""
+		}
+	}
+	if strings.HasPrefix(target, ":") {
+		//A link to a category or file rather than a use of it
+		target = strings.TrimSpace(target[strings.LastIndex(target, ":")+1:])
+	}
+	if sep := strings.Index(target, "#"); sep >= 0 {
+		c.note("Section link [[" + target + "]]")
+		if sep == 0 {
+			if label == "" {
+				label = target[1:]
+			}
+			return label + trail
+		}
+		if !hasLabel {
+			label = target
+		}
+		target = target[:sep]
+	}
+	if target == "" {
+		return match
+	}
+	if hasLabel && label == "" {
+		//The pipe trick: [[Page (disambiguation)|]] is labelled 'Page'
+		label = strings.TrimSpace(pipeTrickRegexp.ReplaceAllString(target, ""))
+	}
+	if label == "" && trail == "" {
+		return "[[" + target + "]]"
+	}
+	if label == "" {
+		label = target
+	}
+	return "[[" + target + "|" + label + trail + "]]"
+}
+
+//Applies bold and italic markup ('' and ''') to a line.
+//Anything left open is closed at the end of the line, as MediaWiki does.
+//Markdown can't express overlapping or empty emphasis, so lines with
+//those get html tags instead.
+func (c *wikitextConverter) emphasis(text string, markers emphasisMarkers) string {
+	var buf bytes.Buffer
+	open := []byte{}
+	tangled := false
+	//Where the last marker ended, and whether it was a closing one
+	lastEnd := -1
+	lastClosed := false
+	//Where the text after each opening marker starts
+	opened := []int{}
+	isOpen := func(kind byte) bool {
+		return bytes.IndexByte(open, kind) >= 0
+	}
+	write := func(kind byte, opening bool) {
+		if buf.Len() == lastEnd && opening == lastClosed {
+			//Nothing between a closing and an opening marker,
+			//or between an opening and a closing one
+			tangled = true
+		}
+		if !opening && buf.Len() > 0 && isSpace(buf.Bytes()[buf.Len()-1]) {
+			tangled = true
+		}
+		switch {
+		case kind == 'i' && opening:
+			buf.WriteString(markers.italicOpen)
+		case kind == 'i':
+			buf.WriteString(markers.italicClose)
+		case opening:
+			buf.WriteString(markers.boldOpen)
+		default:
+			buf.WriteString(markers.boldClose)
+		}
+		if opening {
+			opened = append(opened, buf.Len())
+		}
+		lastEnd = buf.Len()
+		lastClosed = !opening
+	}
+	toggle := func(kind byte) {
+		if !isOpen(kind) {
+			open = append(open, kind)
+			write(kind, true)
+			return
+		}
+		//Close anything opened inside it first, then reopen
+		pos := bytes.IndexByte(open, kind)
+		inner := append([]byte{}, open[pos+1:]...)
+		for i := len(open) - 1; i >= pos; i-- {
+			write(open[i], false)
+		}
+		open = open[:pos]
+		for _, k := range inner {
+			tangled = true
+			open = append(open, k)
+			write(k, true)
+		}
+	}
+	last := 0
+	for _, loc := range apostrophesRegexp.FindAllStringIndex(text, -1) {
+		buf.WriteString(text[last:loc[0]])
+		last = loc[1]
+		n := loc[1] - loc[0]
+		if n == 4 {
+			buf.WriteString("'")
+			n = 3
+		} else if n > 5 {
+			buf.WriteString(strings.Repeat("'", n-5))
+			n = 5
+		}
+		switch {
+		case n == 2:
+			toggle('i')
+		case n == 3:
+			toggle('b')
+		case isOpen('b') && isOpen('i'):
+			for i := len(open) - 1; i >= 0; i-- {
+				write(open[i], false)
+			}
+			open = open[:0]
+		case isOpen('b'):
+			toggle('b')
+			toggle('i')
+		case isOpen('i'):
+			toggle('i')
+			toggle('b')
+		default:
+			toggle('b')
+			toggle('i')
+		}
+	}
+	//Close anything still open before the trailing space
+	rest := text[last:]
+	trimmed := strings.TrimRight(rest, " \t")
+	buf.WriteString(trimmed)
+	for i := len(open) - 1; i >= 0; i-- {
+		write(open[i], false)
+	}
+	buf.WriteString(rest[len(trimmed):])
+	result := buf.String()
+	for _, pos := range opened {
+		if pos >= len(result) || isSpace(result[pos]) {
+			tangled = true
+		}
+	}
+	if tangled && markers != htmlEmphasis {
+		return c.emphasis(text, htmlEmphasis)
+	} else if markers == htmlEmphasis {
+		result = emptyTagsRegexp.ReplaceAllString(result, "")
+	}
+	return result
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t'
+}
+
+//Sets aside the parts of the document that mustn't be converted,
+//removing comments and noting unsupported constructs
+func (c *wikitextConverter) protect(text string) string {
+	text = commentRegexp.ReplaceAllString(text, "")
+	text = nowikiRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		return c.hold(escapeMarkdown(nowikiRegexp.FindStringSubmatch(match)[1]))
+	})
+	text = sourceRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		parts := sourceRegexp.FindStringSubmatch(match)
+		return c.hold("\n```" + parts[2] + "\n" + strings.Trim(parts[3], "\n") + "\n```\n")
+	})
+	text = preRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		content := html.UnescapeString(preRegexp.FindStringSubmatch(match)[1])
+		return c.hold("\n```\n" + strings.Trim(content, "\n") + "\n```\n")
+	})
+	text = magicWordRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		c.note("Magic word " + match)
+		return ""
+	})
+	for _, match := range otherTagRegexp.FindAllStringSubmatch(text, -1) {
+		c.note("Tag <" + strings.ToLower(match[1]) + ">")
+	}
+	return c.protectTemplates(text)
+}
+
+//Sets aside {{templates}}, which are kept as code
+func (c *wikitextConverter) protectTemplates(text string) string {
+	var buf bytes.Buffer
+	for {
+		start := strings.Index(text, "{{")
+		if start < 0 {
+			break
+		}
+		depth, end := 0, -1
+		for i := start; i < len(text)-1 && end < 0; i++ {
+			switch text[i : i+2] {
+			case "{{":
+				depth++
+				i++
+			case "}}":
+				if depth--; depth == 0 {
+					end = i + 2
+				}
+				i++
+			}
+		}
+		if end < 0 {
+			break
+		}
+		template := text[start:end]
+		name := strings.TrimSpace(strings.SplitN(strings.Trim(template, "{}"), "|", 2)[0])
+		c.note("Template {{" + name + "}}")
+		buf.WriteString(text[:start])
+		if strings.Contains(template, "\n") {
+			buf.WriteString(c.hold("\n```\n" + template + "\n```\n"))
+		} else {
+			buf.WriteString(c.hold(codeSpan(template)))
+		}
+		text = text[end:]
+	}
+	buf.WriteString(text)
+	return buf.String()
+}
+
+//Replaces text with a placeholder, restored after conversion
+func (c *wikitextConverter) hold(text string) string {
+	c.protected = append(c.protected, text)
+	return "\x00" + strconv.Itoa(len(c.protected)-1) + "\x00"
+}
+
+func (c *wikitextConverter) restore(text string) string {
+	for placeholderRegexp.MatchString(text) {
+		text = placeholderRegexp.ReplaceAllStringFunc(text, func(match string) string {
+			i, _ := strconv.Atoi(strings.Trim(match, "\x00"))
+			return c.protected[i]
+		})
+	}
+	return text
+}
+
+func (c *wikitextConverter) note(what string) {
+	if !c.noted[what] {
+		c.noted[what] = true
+		c.unsupported = append(c.unsupported, what)
+	}
+}
+
+//Turns a category name into a tag, if it can be one
+func (c *wikitextConverter) addTag(category string) {
+	tag := strings.ToLower(strings.Replace(category, "_", " ", -1))
+	tag = strings.Join(strings.Fields(tagCharsRegexp.ReplaceAllString(tag, " ")), " ")
+	if len(tag) > MaxTagLength || !tagRegexp.MatchString(tag) {
+		c.note("Category " + category)
+		return
+	}
+	for _, t := range c.tags {
+		if t == tag {
+			return
+		}
+	}
+	if len(c.tags) >= MaxTags {
+		c.note("Category " + category)
+		return
+	}
+	c.tags = append(c.tags, tag)
+}
+
+var imageOptions = map[string]bool{
+	"thumb": true, "thumbnail": true, "frame": true, "framed": true,
+	"frameless": true, "border": true, "upright": true, "left": true,
+	"right": true, "center": true, "centre": true, "none": true,
+	"baseline": true, "middle": true, "sub": true, "super": true,
+	"top": true, "text-top": true, "bottom": true, "text-bottom": true,
+}
+
+//Sizes like 200px or 200x100px, and named options like alt=...
+var imageOptionRegexp = regexp.MustCompile(`^(\d*x?\d+\s*px|(?i:alt|link|page|upright|thumb|thumbnail|class|lang)\s*=.*)$`)
+
+var markdownSpecials = strings.NewReplacer(
+	"\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]",
+	"<", "&lt;", ">", "&gt;", "#", "\\#", "!", "\\!", "|", "\\|")
+
+func escapeMarkdown(text string) string {
+	return markdownSpecials.Replace(text)
+}
+
+//The caption of a [[File:...]] link: the last of its parameters
+//which isn't an image option like 'thumb', 'left' or '200px'
+func fileCaption(params string) string {
+	parts := strings.Split(params, "|")
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := strings.TrimSpace(parts[i])
+		if part != "" && !imageOptions[strings.ToLower(part)] &&
+			!imageOptionRegexp.MatchString(part) {
+			return part
+		}
+	}
+	return ""
+}
+
+func stripEmphasis(text string) string {
+	return strings.TrimSpace(apostrophesRegexp.ReplaceAllString(text, ""))
+}
+
+//Wraps text in a code span, with enough backticks to contain it
+func codeSpan(text string) string {
+	ticks := "`"
+	for strings.Contains(text, ticks) {
+		ticks += "`"
+	}
+	//Padding keeps backticks at the edges apart from the delimiters
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return ticks + text + ticks
+}
@@ -0,0 +1,139 @@
+/*
+ *  Licensed to Wikifeat under one or more contributor license agreements.
+ *  See the LICENSE.txt file distributed with this work for additional information
+ *  regarding copyright ownership.
+ *
+ *  Redistribution and use in source and binary forms, with or without
+ *  modification, are permitted provided that the following conditions are met:
+ *
+ *  * Redistributions of source code must retain the above copyright notice,
+ *  this list of conditions and the following disclaimer.
+ *  * Redistributions in binary form must reproduce the above copyright
+ *  notice, this list of conditions and the following disclaimer in the
+ *  documentation and/or other materials provided with the distribution.
+ *  * Neither the name of Wikifeat nor the names of its contributors may be used
+ *  to endorse or promote products derived from this software without
+ *  specific prior written permission.
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wikit_test
+
+import (
+	. "github.com/rhinoman/wikifeat/wikis/wiki_service/wikit"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWikitextToMarkdown(t *testing.T) {
+	cases := []struct {
+		wikitext    string
+		markdown    string
+		tags        []string
+		unsupported []string
+	}{
+		{"== Install ==\nSome '''bold''' and ''italic'' text.",
+			"## Install\n\nSome **bold** and *italic* text.\n", nil, nil},
+		{"* one\n** two\n# first\n# second",
+			"- one\n  - two\n1. first\n1. second\n", nil, nil},
+		{"See [[Main_Page|home]] and [[apple]]s or [http://example.com Example].",
+			"See [[Main Page|home]] and [[apple|apples]] or [Example](http://example.com).\n",
+			nil, nil},
+		{"{|\n! A !! B\n|-\n| 1 || 2\n|}",
+			"<table>\n<tr><th>A</th><th>B</th></tr>\n<tr><td>1</td><td>2</td></tr>\n</table>\n",
+			nil, nil},
+		{"'''unclosed\n''italic '''both''' end''",
+			"**unclosed**\n*italic **both** end*\n", nil, nil},
+		{"'''bold ''both''' italic''",
+			"<strong>bold <em>both</em></strong><em> italic</em>\n", nil, nil},
+		{"See [[File:x.png|thumb]][[File:y.png|thumb|left|200px|A caption]]",
+			"See A caption\n", nil,
+			[]string{"File link [[File:x.png]]", "File link [[File:y.png]]"}},
+		{"Text {{Infobox|x=1}}\n[[Category:How To]]",
+			"Text `{{Infobox|x=1}}`\n",
+			[]string{"how to"}, []string{"Template {{Infobox}}"}},
+	}
+	for _, c := range cases {
+		conv := WikitextToMarkdown(c.wikitext)
+		if conv.Markdown != c.markdown {
+			t.Errorf("Converting %q: expected %q, got %q", c.wikitext, c.markdown, conv.Markdown)
+		}
+		if len(conv.Tags) != len(c.tags) || (len(c.tags) > 0 && !reflect.DeepEqual(conv.Tags, c.tags)) {
+			t.Errorf("Converting %q: expected tags %v, got %v", c.wikitext, c.tags, conv.Tags)
+		}
+		if len(conv.Unsupported) != len(c.unsupported) ||
+			(len(c.unsupported) > 0 && !reflect.DeepEqual(conv.Unsupported, c.unsupported)) {
+			t.Errorf("Converting %q: expected unsupported %v, got %v",
+				c.wikitext, c.unsupported, conv.Unsupported)
+		}
+	}
+	conv := WikitextToMarkdown("#REDIRECT [[Other Page]]")
+	if conv.Redirect != "Other Page" {
+		t.Errorf("Expected a redirect to 'Other Page', got %q", conv.Redirect)
+	}
+}
+
+func TestReadMediaWikiDump(t *testing.T) {
+	dump := `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/">
+  <siteinfo><sitename>Test</sitename></siteinfo>
+  <page>
+    <title>Main_Page</title>
+    <ns>0</ns>
+    <revision>
+      <id>2</id>
+      <timestamp>2015-06-02T10:00:00Z</timestamp>
+      <contributor><ip>10.0.0.1</ip></contributor>
+      <text>Second</text>
+    </revision>
+    <revision>
+      <id>1</id>
+      <timestamp>2015-06-01T10:00:00Z</timestamp>
+      <contributor><username>Alice</username><id>1</id></contributor>
+      <comment>First!</comment>
+      <text>First</text>
+    </revision>
+  </page>
+  <page>
+    <title>Talk:Main_Page</title>
+    <ns>1</ns>
+    <revision><timestamp>2015-06-03T10:00:00Z</timestamp><text>Hi</text></revision>
+  </page>
+</mediawiki>`
+	pages := []MediaWikiPage{}
+	err := ReadMediaWikiDump(strings.NewReader(dump), func(page *MediaWikiPage) error {
+		pages = append(pages, *page)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %v", len(pages))
+	}
+	if pages[0].Title != "Main_Page" || pages[1].Namespace != 1 {
+		t.Errorf("Unexpected pages: %v", pages)
+	}
+	revs := pages[0].Revisions
+	if len(revs) != 2 || revs[0].Text != "First" || revs[1].Text != "Second" {
+		t.Fatalf("Expected revisions oldest first, got %v", revs)
+	}
+	if revs[0].Editor() != "Alice" || revs[1].Editor() != "10.0.0.1" {
+		t.Errorf("Unexpected editors %v, %v", revs[0].Editor(), revs[1].Editor())
+	}
+	if !revs[0].Timestamp.Equal(time.Date(2015, 6, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected timestamp %v", revs[0].Timestamp)
+	}
+}
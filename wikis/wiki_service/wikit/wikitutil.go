@@ -63,7 +63,9 @@ var wikiViews = map[string]View{
 					{documentId: doc._id,
 					 documentRev: doc._rev,
 					 editor: doc.editor,
-					 contentSize: doc.content.raw.length}
+					 contentSize: doc.content.raw.length,
+					 revertedFrom: doc.revertedFrom,
+					 pageRev: doc.pageRev}
 				);
 			}
 		}`,
@@ -81,7 +83,8 @@ var wikiViews = map[string]View{
 							title: doc.title,
 							owner: doc.owner,
 							editor: doc.editor,
-							timestamp: doc.timestamp
+							timestamp: doc.timestamp,
+							restriction: doc.restriction
 						});
 					}
 				}
@@ -118,6 +121,18 @@ var wikiViews = map[string]View{
 				}
 			}`,
 	},
+	"getPageByPreviousSlug": {
+		Map: `
+			function(doc){
+				//History copies keep their previous slugs, skip them
+				if(doc.type==="page" && doc.previousSlugs &&
+						doc._id===doc.owningPage){
+					for(var i in doc.previousSlugs){
+						emit(doc.previousSlugs[i], {pageRev: doc._rev, page: doc});
+					}
+				}
+			}`,
+	},
 	"getChildPageIndex": {
 		Map: `
 			function(doc) {
@@ -130,7 +145,8 @@ var wikiViews = map[string]View{
 							title: doc.title,
 							owner: doc.owner,
 							editor: doc.editor,
-							timestamp: doc.timestamp
+							timestamp: doc.timestamp,
+							restriction: doc.restriction
 						});
 					}
 				}
@@ -153,6 +169,68 @@ var wikiViews = map[string]View{
 			}
 		`,
 	},
+	"getBacklinks": {
+		Map: `
+			function(doc){
+				if(doc.type==="page"){
+					var owningPage = doc.owningPage || doc.owning_page;
+					if(doc._id === owningPage && doc.links){
+						for(var i in doc.links){
+							if(doc.links[i].pageId){
+								emit(doc.links[i].pageId, {
+									id: doc._id,
+									slug: doc.slug,
+									title: doc.title,
+									owner: doc.owner,
+									editor: doc.editor,
+									timestamp: doc.timestamp,
+									restriction: doc.restriction
+								});
+							}
+						}
+					}
+				}
+			}`,
+		Reduce: "_count",
+	},
+	"getMissingLinks": {
+		Map: `
+			function(doc){
+				if(doc.type==="page"){
+					var owningPage = doc.owningPage || doc.owning_page;
+					if(doc._id === owningPage && doc.links){
+						for(var i in doc.links){
+							if(!doc.links[i].pageId && doc.links[i].wikiId){
+								emit([doc.links[i].wikiId, doc.links[i].slug], null);
+							}
+						}
+					}
+				}
+			}`,
+	},
+	"getPagesByTag": {
+		Map: `
+			function(doc){
+				if(doc.type==="page"){
+					var owningPage = doc.owningPage || doc.owning_page;
+					if(doc._id === owningPage && doc.tags){
+						for(var i in doc.tags){
+							emit(doc.tags[i], {
+								id: doc._id,
+								slug: doc.slug,
+								title: doc.title,
+								owner: doc.owner,
+								editor: doc.editor,
+								timestamp: doc.timestamp,
+								tags: doc.tags,
+								restriction: doc.restriction
+							});
+						}
+					}
+				}
+			}`,
+		Reduce: "_count",
+	},
 	"checkUniqueSlug": {
 		Map: `
 			function(doc){
@@ -163,6 +241,85 @@ var wikiViews = map[string]View{
 		`,
 		Reduce: "_count",
 	},
+	"getRecentChanges": {
+		Map: `
+			function(doc){
+				var owningPage = doc.owningPage || doc.owning_page;
+				if(doc.type==="page"){
+					emit(doc.timestamp, {
+						type: doc.change || "edited",
+						pageId: owningPage,
+						title: doc.title,
+						user: doc.editor,
+						timestamp: doc.timestamp,
+						revertedFrom: doc.revertedFrom
+					});
+				} else if(doc.type==="comment"){
+					emit(doc.createdTime, {
+						type: "commented",
+						pageId: owningPage,
+						user: doc.author,
+						timestamp: doc.createdTime
+					});
+				} else if(doc.type==="deletion"){
+					emit(doc.timestamp, {
+						type: "deleted",
+						pageId: doc.pageId,
+						title: doc.title,
+						slug: doc.slug,
+						user: doc.editor,
+						timestamp: doc.timestamp,
+						restriction: doc.restriction
+					});
+				}
+			}`,
+	},
+	"getUserActivity": {
+		Map: `
+			function(doc){
+				var owningPage = doc.owningPage || doc.owning_page;
+				if(doc.type==="page" && doc.editor){
+					emit([doc.editor, doc.timestamp], {
+						type: doc.change || "edited",
+						pageId: owningPage,
+						title: doc.title,
+						user: doc.editor,
+						timestamp: doc.timestamp,
+						revertedFrom: doc.revertedFrom
+					});
+				} else if(doc.type==="comment" && doc.author){
+					emit([doc.author, doc.createdTime], {
+						type: "commented",
+						pageId: owningPage,
+						user: doc.author,
+						timestamp: doc.createdTime
+					});
+				} else if(doc.type==="file" && doc.uploadedBy){
+					emit([doc.uploadedBy, doc.timestamp], {
+						type: "uploaded",
+						title: doc.name,
+						user: doc.uploadedBy,
+						timestamp: doc.timestamp
+					});
+				}
+			}`,
+	},
+	"getWatchesByPage": {
+		Map: `
+			function(doc){
+				if(doc.type==="watch"){
+					emit(doc.pageId, doc);
+				}
+			}`,
+	},
+	"getWatchesByUser": {
+		Map: `
+			function(doc){
+				if(doc.type==="watch"){
+					emit(doc.user, doc);
+				}
+			}`,
+	},
 }
 
 var commentViews = map[string]View{
@@ -176,6 +333,32 @@ var commentViews = map[string]View{
 			}`,
 		Reduce: "_count",
 	},
+	"getCommentThreads": {
+		Map: `
+			function(doc){
+				if(doc.type==="comment" && !doc.parentComment){
+					emit([doc.owningPage, doc.createdTime], doc);
+				}
+			}`,
+		Reduce: "_count",
+	},
+	"getCommentReplies": {
+		Map: `
+			function(doc){
+				if(doc.type==="comment" && doc.parentComment){
+					emit([doc.owningPage, doc.parentComment, doc.createdTime], doc);
+				}
+			}`,
+		Reduce: "_count",
+	},
+	"getRepliesByThread": {
+		Map: `
+			function(doc){
+				if(doc.type==="comment" && doc.parentComment){
+					emit([doc.owningPage, doc.parentComment], doc);
+				}
+			}`,
+	},
 }
 
 //Populate a database with views, etc.
@@ -197,6 +380,14 @@ func InitDb(db *Database, wikiName string) error {
 		db.Delete("_design/wikit", desRev)
 		return err
 	}
+	template_ddoc := DesignDocument{
+		Language: "javascript",
+		Views:    templateViews,
+	}
+	_, err = db.SaveDesignDoc("wikit_templates", template_ddoc, "")
+	if err != nil {
+		return err
+	}
 	//setup up roles
 	sec, err := db.GetSecurity()
 	if err != nil {
@@ -226,6 +417,63 @@ func InitDb(db *Database, wikiName string) error {
 	return nil
 }
 
+//Brings the design documents of an existing wiki database up to date.
+//Views added in later versions are installed, changed views are replaced
+func UpdateDesignDocs(db *Database, wikiName string) error {
+	designDocs := map[string]map[string]View{
+		"wikit":           wikiViews,
+		"wikit_comments":  commentViews,
+		"wikit_templates": templateViews,
+	}
+	for name, views := range designDocs {
+		if err := updateViews(db, name, views); err != nil {
+			return err
+		}
+	}
+	validator := createValidator(wikiName, wikiName+":write", wikiName+":admin")
+	adoc := AuthDesignDocument{}
+	rev, err := readDesignDoc(db, "_auth", &adoc)
+	if err != nil {
+		return err
+	}
+	if rev != "" && adoc.ValidateDocUpdate == validator {
+		return nil
+	}
+	adoc = AuthDesignDocument{
+		Language:          "javascript",
+		ValidateDocUpdate: validator,
+	}
+	_, err = db.SaveDesignDoc("_auth", adoc, rev)
+	return err
+}
+
+//Saves a design document's views, unless they are already up to date
+func updateViews(db *Database, name string, views map[string]View) error {
+	ddoc := DesignDocument{}
+	rev, err := readDesignDoc(db, name, &ddoc)
+	if err != nil {
+		return err
+	}
+	if rev != "" && reflect.DeepEqual(ddoc.Views, views) {
+		return nil
+	}
+	ddoc = DesignDocument{
+		Language: "javascript",
+		Views:    views,
+	}
+	_, err = db.SaveDesignDoc(name, ddoc, rev)
+	return err
+}
+
+//Reads a design document.  Returns an empty revision if it doesn't exist
+func readDesignDoc(db *Database, name string, ddoc interface{}) (string, error) {
+	rev, err := db.Read("_design/"+name, ddoc, nil)
+	if cErr, ok := err.(*Error); ok && cErr.StatusCode == 404 {
+		return "", nil
+	}
+	return rev, err
+}
+
 func createValidator(wikiName string, writeRole string,
 	adminRole string) string {
 
@@ -237,6 +485,41 @@ func createValidator(wikiName string, writeRole string,
 		"(userCtx.roles.indexOf('_admin') == -1)){" +
 		"throw({forbidden: \"Not Authorized\"});" +
 		"}" +
+		//Drafts may only be written by their owners
+		"if((newDoc.type === 'draft' || (oldDoc && oldDoc.type === 'draft')) &&" +
+		"(userCtx.roles.indexOf('_admin') == -1)){" +
+		"if((!newDoc._deleted && newDoc.owner !== userCtx.name) ||" +
+		"(oldDoc && oldDoc.owner !== userCtx.name)){" +
+		"throw({forbidden: \"Drafts are private\"});" +
+		"}" +
+		"}" +
+		//Restricted pages may only be written by the users and roles
+		//they're restricted to, and by admins
+		"function allows(r){" +
+		"if(!r){return true;}" +
+		"if(r.users && r.users.indexOf(userCtx.name) != -1){return true;}" +
+		"for(var i in r.roles){" +
+		"if(userCtx.roles.indexOf(r.roles[i]) != -1){return true;}" +
+		"}" +
+		"return false;" +
+		"}" +
+		"function own(doc){" +
+		"return (doc && doc.restriction && !doc.restriction.source) ?" +
+		"JSON.stringify(doc.restriction) : '';" +
+		"}" +
+		"if((userCtx.roles.indexOf('" + adminRole + "') == -1) &&" +
+		"(userCtx.roles.indexOf('admin') == -1) &&" +
+		"(userCtx.roles.indexOf('master') == -1) &&" +
+		"(userCtx.roles.indexOf('_admin') == -1)){" +
+		"if((oldDoc && !allows(oldDoc.restriction)) ||" +
+		"(!newDoc._deleted && !allows(newDoc.restriction))){" +
+		"throw({forbidden: \"Page is restricted\"});" +
+		"}" +
+		//Only admins may set or lift a page's own restriction
+		"if(oldDoc && !newDoc._deleted && own(oldDoc) !== own(newDoc)){" +
+		"throw({forbidden: \"Only admins may change page restrictions\"});" +
+		"}" +
+		"}" +
 		"}"
 
 	return validationFunc